@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header carrying the request ID, received from a proxy or a caller and
+// passed on with the calls to other services, so a message can be matched
+// with the request that caused it
+const HeaderRequestID = "X-Request-ID"
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// Request IDs accepted from the caller; anything else is replaced, so a
+// client cannot inject arbitrary text in the logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Generate a new request ID
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// Context carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Request ID of a context, empty when it has none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Response writer remembering the status code, for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware giving every request an ID, taken from the X-Request-ID header
+// when it is valid, returning it in the response and logging the outcome of
+// the request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = NewRequestID()
+		}
+		ctx := WithRequestID(r.Context(), id)
+		w.Header().Set(HeaderRequestID, id)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		// the probes and the scrapes come every few seconds
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/metrics" {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr)
+	})
+}
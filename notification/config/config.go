@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"progetto/logging"
+	"strings"
+	"time"
+)
+
+// Settings of the notification service. Every setting has a default, can be
+// set in the YAML configuration file and overridden by its environment
+// variable and then by its command-line flag.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Templates TemplatesConfig `yaml:"templates"`
+	Queue     QueueConfig     `yaml:"queue"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	SMTP      SMTPConfig      `yaml:"smtp"`
+	Webhook   WebhookConfig   `yaml:"webhook"`
+	SMS       SMSConfig       `yaml:"sms"`
+	// Where the log channel writes, either "stdout" or the path of a file;
+	// empty disables the channel
+	LogSink string `yaml:"log_sink"`
+	// Keys accepted for signed requests, by ID
+	SigningKeys map[string]string `yaml:"signing_keys"`
+	Log         LogConfig         `yaml:"log"`
+}
+
+type ServerConfig struct {
+	// Address the HTTP server listens on, e.g. ":8081"
+	Addr string `yaml:"addr"`
+	// Longest time to read a request and to write its response
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// How long an idle keep-alive connection is kept open
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// How long the requests in flight are waited for at shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	Path string `yaml:"path"`
+}
+
+type TemplatesConfig struct {
+	// Directory of the message templates
+	Dir string `yaml:"dir"`
+}
+
+type QueueConfig struct {
+	// Messages delivered at the same time
+	Workers int `yaml:"workers"`
+	// Messages sent every hour at most; zero disables the quota
+	HourlyQuota int `yaml:"hourly_quota"`
+}
+
+// Limits on the accepted messages; zero disables a limit
+type LimitsConfig struct {
+	CallerPerMinute  int `yaml:"caller_per_minute"`
+	RecipientPerHour int `yaml:"recipient_per_hour"`
+}
+
+// SMTP server used to send the emails
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
+type WebhookConfig struct {
+	// Empty disables the channel
+	URL string `yaml:"url"`
+}
+
+type SMSConfig struct {
+	// Empty disables the channel
+	GatewayURL string `yaml:"gateway_url"`
+	Token      string `yaml:"token"`
+	Sender     string `yaml:"sender"`
+}
+
+type LogConfig struct {
+	// Lowest level written: debug, info, warn or error
+	Level string `yaml:"level"`
+	// Output format: json or text
+	Format string `yaml:"format"`
+}
+
+// Settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8081",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Path: "./notification.db",
+		},
+		Templates: TemplatesConfig{
+			Dir: "./templates",
+		},
+		Queue: QueueConfig{
+			Workers:     4,
+			HourlyQuota: 500,
+		},
+		Limits: LimitsConfig{
+			CallerPerMinute:  60,
+			RecipientPerHour: 10,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+	}
+}
+
+// Helper function to check that a setting is an absolute http(s) URL
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL, got %q", name, value)
+	}
+	return nil
+}
+
+// Check the settings, reporting every invalid one
+func (c *Config) Validate() error {
+	var errs []error
+
+	if !strings.Contains(c.Server.Addr, ":") {
+		errs = append(errs, fmt.Errorf("server.addr must be host:port or :port, got %q", c.Server.Addr))
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.name, d.value))
+		}
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path is required"))
+	}
+	if c.Templates.Dir == "" {
+		errs = append(errs, errors.New("templates.dir is required"))
+	}
+
+	if c.Queue.Workers < 1 {
+		errs = append(errs, fmt.Errorf("queue.workers must be at least 1, got %d", c.Queue.Workers))
+	}
+	if c.Queue.HourlyQuota < 0 || c.Limits.CallerPerMinute < 0 || c.Limits.RecipientPerHour < 0 {
+		errs = append(errs, errors.New("limits and quota cannot be negative"))
+	}
+
+	// every channel is optional, but messages need at least one
+	if c.SMTP.Host == "" && c.Webhook.URL == "" && c.SMS.GatewayURL == "" && c.LogSink == "" {
+		errs = append(errs, errors.New("no delivery channel is configured: set smtp.host, webhook.url, sms.gateway_url or log_sink"))
+	}
+
+	if c.SMTP.Host != "" || c.SMTP.Email != "" || c.SMTP.Password != "" {
+		if c.SMTP.Host == "" || c.SMTP.Email == "" || c.SMTP.Password == "" {
+			errs = append(errs, errors.New("smtp.host, smtp.email and smtp.password are required to send emails"))
+		}
+		if c.SMTP.Port < 1 || c.SMTP.Port > 65535 {
+			errs = append(errs, fmt.Errorf("smtp.port must be between 1 and 65535, got %d", c.SMTP.Port))
+		}
+		if c.SMTP.Email != "" {
+			if _, err := mail.ParseAddress(c.SMTP.Email); err != nil {
+				errs = append(errs, fmt.Errorf("smtp.email is not a valid address: %q", c.SMTP.Email))
+			}
+		}
+	}
+
+	if c.Webhook.URL != "" {
+		if err := validateURL("webhook.url", c.Webhook.URL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.SMS.GatewayURL != "" {
+		if err := validateURL("sms.gateway_url", c.SMS.GatewayURL); err != nil {
+			errs = append(errs, err)
+		}
+		if c.SMS.Token == "" {
+			errs = append(errs, errors.New("sms.token is required with sms.gateway_url"))
+		}
+	}
+
+	if len(c.SigningKeys) == 0 {
+		errs = append(errs, errors.New("signing_keys is required: every caller must sign its requests"))
+	}
+	for id, secret := range c.SigningKeys {
+		if id == "" || len(secret) < 16 {
+			errs = append(errs, fmt.Errorf("signing key %q needs an ID and a secret of at least 16 characters", id))
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		errs = append(errs, fmt.Errorf("log.format must be json or text, got %q", c.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Copy of the settings with the secrets hidden, for printing
+func (c Config) Redacted() Config {
+	if c.SMTP.Password != "" {
+		c.SMTP.Password = redacted
+	}
+	if c.SMS.Token != "" {
+		c.SMS.Token = redacted
+	}
+	keys := make(map[string]string, len(c.SigningKeys))
+	for id := range c.SigningKeys {
+		keys[id] = redacted
+	}
+	c.SigningKeys = keys
+	return c
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Shown instead of the secrets by --print-config
+const redacted = "<redacted>"
+
+// Environment variable naming the configuration file, when --config is not
+// given
+const configFileEnv = "NOTIFICATION_CONFIG"
+
+// A setting that can be overridden by an environment variable and by a flag.
+// Either name can be empty: secrets have no flag, so they never show up in
+// the process list.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(string) error
+}
+
+// Helper function to build the setting of a string
+func stringSetting(env, flagName, usage string, p *string) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		*p = value
+		return nil
+	}}
+}
+
+// Helper function to build the setting of a duration, e.g. "90s"
+func durationSetting(env, flagName, usage string, p *time.Duration) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}}
+}
+
+// Helper function to build the setting of a number
+func intSetting(env, flagName, usage string, p *int) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = n
+		return nil
+	}}
+}
+
+// Helper function to build the setting of the signing keys, a comma-separated
+// list of id:secret pairs
+func keysSetting(env string, p *map[string]string) setting {
+	return setting{env, "", "", func(value string) error {
+		keys := map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok {
+				return fmt.Errorf("%q is not an id:secret pair", pair)
+			}
+			if _, exists := keys[id]; exists {
+				return fmt.Errorf("duplicate signing key %q", id)
+			}
+			keys[id] = secret
+		}
+		*p = keys
+		return nil
+	}}
+}
+
+// Helper function to list the settings of c
+func settings(c *Config) []setting {
+	return []setting{
+		stringSetting("NOTIFICATION_ADDR", "addr", "address the HTTP server listens on", &c.Server.Addr),
+		durationSetting("NOTIFICATION_READ_TIMEOUT", "", "", &c.Server.ReadTimeout),
+		durationSetting("NOTIFICATION_WRITE_TIMEOUT", "", "", &c.Server.WriteTimeout),
+		durationSetting("NOTIFICATION_IDLE_TIMEOUT", "", "", &c.Server.IdleTimeout),
+		durationSetting("NOTIFICATION_SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long the requests in flight are waited for at shutdown", &c.Server.ShutdownTimeout),
+		stringSetting("NOTIFICATION_DATABASE_PATH", "db", "path of the SQLite database", &c.Database.Path),
+		stringSetting("NOTIFICATION_TEMPLATES_DIR", "templates", "directory of the message templates", &c.Templates.Dir),
+		intSetting("NOTIFICATION_WORKERS", "workers", "messages delivered at the same time", &c.Queue.Workers),
+		intSetting("NOTIFICATION_HOURLY_QUOTA", "hourly-quota", "messages sent every hour at most, 0 for no quota", &c.Queue.HourlyQuota),
+		intSetting("NOTIFICATION_CALLER_LIMIT", "caller-limit", "messages accepted from a caller every minute, 0 for no limit", &c.Limits.CallerPerMinute),
+		intSetting("NOTIFICATION_RECIPIENT_LIMIT", "recipient-limit", "messages accepted for a recipient every hour, 0 for no limit", &c.Limits.RecipientPerHour),
+		stringSetting("SMTP_HOST", "smtp-host", "host of the SMTP server", &c.SMTP.Host),
+		intSetting("SMTP_PORT", "smtp-port", "port of the SMTP server", &c.SMTP.Port),
+		stringSetting("SMTP_EMAIL", "smtp-email", "sender address and SMTP user", &c.SMTP.Email),
+		stringSetting("SMTP_PASSWORD", "", "", &c.SMTP.Password),
+		stringSetting("WEBHOOK_URL", "webhook-url", "address the webhook channel posts to", &c.Webhook.URL),
+		stringSetting("SMS_GATEWAY_URL", "sms-gateway-url", "address of the SMS gateway", &c.SMS.GatewayURL),
+		stringSetting("SMS_GATEWAY_TOKEN", "", "", &c.SMS.Token),
+		stringSetting("SMS_SENDER", "sms-sender", "sender of the SMS", &c.SMS.Sender),
+		stringSetting("LOG_SINK", "log-sink", `where the log channel writes, "stdout" or a file`, &c.LogSink),
+		keysSetting("NOTIFICATION_SIGNING_KEYS", &c.SigningKeys),
+		stringSetting("NOTIFICATION_LOG_LEVEL", "log-level", "lowest level logged: debug, info, warn or error", &c.Log.Level),
+		stringSetting("NOTIFICATION_LOG_FORMAT", "log-format", "format of the logs: json or text", &c.Log.Format),
+	}
+}
+
+// Flag value keeping the text given on the command line, applied after the
+// file and the environment
+type flagValue struct {
+	value string
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// Load the settings, starting from defaults and applying in order the
+// configuration file, the environment and the command-line flags in args.
+// The file is given with --config or NOTIFICATION_CONFIG, and the
+// environment can be completed by a .env file. With --print-config
+// the settings are printed to out and printOnly is true.
+func Load(defaults Config, args []string, out io.Writer) (cfg Config, printOnly bool, err error) {
+	cfg = defaults
+	list := settings(&cfg)
+
+	fs := flag.NewFlagSet("notification", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(configFileEnv), "path of the YAML configuration file")
+	printConfig := fs.Bool("print-config", false, "print the configuration and exit")
+	flags := map[string]*flagValue{}
+	for _, s := range list {
+		if s.flag == "" {
+			continue
+		}
+		flags[s.flag] = &flagValue{}
+		fs.Var(flags[s.flag], s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	// variables already in the environment win over the .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, false, fmt.Errorf("error loading the .env file: %v", err)
+	}
+
+	if *configFile != "" {
+		file, err := os.Open(*configFile)
+		if err != nil {
+			return cfg, false, fmt.Errorf("error reading configuration file: %v", err)
+		}
+		defer file.Close()
+
+		// unknown keys are errors, so a typo does not silently keep a default
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, false, fmt.Errorf("error parsing %s: %v", *configFile, err)
+		}
+	}
+
+	for _, s := range list {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(value); err != nil {
+				return cfg, false, fmt.Errorf("invalid value for %s: %v", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range list {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(flags[s.flag].value); err != nil {
+					flagErr = fmt.Errorf("invalid value for --%s: %v", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, false, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, false, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	if *printConfig {
+		return cfg, true, Print(cfg, out)
+	}
+	return cfg, false, nil
+}
+
+// Print the settings as YAML, with the secrets hidden
+func Print(cfg Config, out io.Writer) error {
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"progetto/logging"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var db *sql.DB
+
+const schema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	caller TEXT NOT NULL DEFAULT '',
+	channel TEXT NOT NULL DEFAULT 'email',
+	recipient TEXT NOT NULL,
+	template TEXT NOT NULL DEFAULT '',
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL,
+	html_body TEXT NOT NULL DEFAULT '',
+	calendar TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'queued' CHECK(status IN ('queued', 'sending', 'sent', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	sent_at TIMESTAMP,
+	request_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_due ON messages(status, next_attempt_at);
+
+-- Recipients no message is sent to, e.g. addresses that bounced or asked to
+-- stop receiving messages
+CREATE TABLE IF NOT EXISTS suppressions (
+	recipient TEXT PRIMARY KEY COLLATE NOCASE,
+	reason TEXT NOT NULL CHECK(reason IN ('bounced', 'unsubscribed', 'complaint', 'manual')),
+	created_at TIMESTAMP NOT NULL
+);
+
+-- Nonces of the signed requests already accepted, kept until a request with
+-- the same timestamp could no longer be accepted
+CREATE TABLE IF NOT EXISTS request_nonces (
+	key_id TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (key_id, nonce)
+);
+`
+
+// Indexes of the rate limits and of the hourly quota
+const indexes = `
+CREATE INDEX IF NOT EXISTS idx_messages_caller ON messages(caller, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages(recipient COLLATE NOCASE, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_sent ON messages(sent_at);
+`
+
+// Open the database and create its tables.
+// Transactions are started with BEGIN IMMEDIATE so that two workers can never
+// claim the same message.
+func InitDatabase(dbPath string) {
+	var err error
+	db, err = sql.Open("sqlite3", dbPath+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		logging.Fatal("Error opening database", "error", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		logging.Fatal("Error creating database schema", "error", err)
+	}
+
+	// databases created by older versions
+	upgrades := []struct{ column, definition string }{
+		{"caller", "TEXT NOT NULL DEFAULT ''"},
+		{"channel", "TEXT NOT NULL DEFAULT 'email'"},
+		{"template", "TEXT NOT NULL DEFAULT ''"},
+		{"html_body", "TEXT NOT NULL DEFAULT ''"},
+		{"calendar", "TEXT NOT NULL DEFAULT ''"},
+		{"request_id", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, u := range upgrades {
+		if err := addColumnIfMissing("messages", u.column, u.definition); err != nil {
+			logging.Fatal("Error upgrading database schema", "error", err)
+		}
+	}
+
+	// after the upgrades, since they use the new columns
+	if _, err := db.Exec(indexes); err != nil {
+		logging.Fatal("Error creating database indexes", "error", err)
+	}
+}
+
+// Helper function to add a column to a table created by an older version
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// Check that the database answers
+func PingDatabase(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+// Close Database
+func CloseDatabase() {
+	if err := db.Close(); err != nil {
+		logging.Fatal("Error closing database", "error", err)
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	StatusQueued  = "queued"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+var (
+	// Returned when the caller queued too many messages in the last minute
+	ErrCallerRateLimited = errors.New("caller rate limit exceeded")
+	// Returned when too many messages were queued for the recipient in the
+	// last hour
+	ErrRecipientRateLimited = errors.New("recipient rate limit exceeded")
+	// Returned when the recipient is in the suppression list
+	ErrRecipientSuppressed = errors.New("recipient suppressed")
+	// Returned when the messages sent in the last hour reached the quota
+	ErrQuotaExceeded = errors.New("hourly quota exceeded")
+)
+
+// Limits on the messages accepted by the service; zero disables a limit
+type RateLimits struct {
+	// Messages a caller can queue in a minute
+	CallerPerMinute int
+	// Messages that can be queued for the same recipient in an hour
+	RecipientPerHour int
+}
+
+// Message accepted by the service and its delivery state
+type Message struct {
+	ID string
+	// Key ID of the service that queued the message
+	Caller    string
+	Channel   string
+	Recipient string
+	// Name of the template the message was rendered from, if any
+	Template string
+	Subject  string
+	Body     string
+	HTMLBody string
+	// Calendar event as JSON, empty when there is none
+	Calendar      string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	SentAt        *time.Time
+	// ID of the request that queued the message, for the logs
+	RequestID string
+}
+
+const messageColumns = `id, caller, channel, recipient, template, subject, body, html_body, calendar, status, attempts, next_attempt_at, last_error, created_at, updated_at, sent_at, request_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row scanner) (*Message, error) {
+	var m Message
+	var sentAt sql.NullTime
+	err := row.Scan(&m.ID, &m.Caller, &m.Channel, &m.Recipient, &m.Template, &m.Subject, &m.Body, &m.HTMLBody, &m.Calendar, &m.Status, &m.Attempts,
+		&m.NextAttemptAt, &m.LastError, &m.CreatedAt, &m.UpdatedAt, &sentAt, &m.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		m.SentAt = &sentAt.Time
+	}
+	return &m, nil
+}
+
+// Helper function to count the messages matching a condition since a time
+func countMessagesSince(tx *sql.Tx, condition string, arg any, since time.Time) (int, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM messages WHERE "+condition+" AND created_at > ?", arg, since.UTC()).Scan(&n)
+	return n, err
+}
+
+// Queue a message for delivery, unless the recipient is suppressed or a rate
+// limit is exceeded. Caller, channel, recipient, template and contents come
+// from m; the ID, status and timestamps are set here. The checks and the
+// insert share a transaction, so concurrent requests cannot overshoot a limit.
+func InsertMessage(m *Message, limits RateLimits) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	if _, err := getSuppression(tx, m.Recipient); err == nil {
+		return ErrRecipientSuppressed
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if limits.CallerPerMinute > 0 {
+		n, err := countMessagesSince(tx, "caller = ?", m.Caller, now.Add(-time.Minute))
+		if err != nil {
+			return err
+		}
+		if n >= limits.CallerPerMinute {
+			return ErrCallerRateLimited
+		}
+	}
+	if limits.RecipientPerHour > 0 {
+		n, err := countMessagesSince(tx, "recipient = ? COLLATE NOCASE", m.Recipient, now.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if n >= limits.RecipientPerHour {
+			return ErrRecipientRateLimited
+		}
+	}
+
+	m.ID = uuid.NewString()
+	m.Status = StatusQueued
+	m.Attempts = 0
+	m.NextAttemptAt = now
+	m.CreatedAt = now
+	m.UpdatedAt = now
+
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, caller, channel, recipient, template, subject, body, html_body, calendar, status, next_attempt_at, created_at, updated_at, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, m.Caller, m.Channel, m.Recipient, m.Template, m.Subject, m.Body, m.HTMLBody, m.Calendar, m.Status, m.NextAttemptAt, m.CreatedAt, m.UpdatedAt, m.RequestID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get a message by ID
+func GetMessage(id string) (*Message, error) {
+	return scanMessage(db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ?", id))
+}
+
+// Claim the oldest queued message whose next attempt is due, marking it as
+// being sent. Returns sql.ErrNoRows when nothing is due, and ErrQuotaExceeded
+// when the messages sent in the last hour, or being sent, reached
+// hourlyQuota; zero disables the quota.
+func ClaimNextMessage(hourlyQuota int) (*Message, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if hourlyQuota > 0 {
+		var sent int
+		err := tx.QueryRow("SELECT COUNT(*) FROM messages WHERE sent_at > ? OR status = 'sending'", now.Add(-time.Hour)).Scan(&sent)
+		if err != nil {
+			return nil, err
+		}
+		if sent >= hourlyQuota {
+			return nil, ErrQuotaExceeded
+		}
+	}
+	m, err := scanMessage(tx.QueryRow(`
+		SELECT `+messageColumns+` FROM messages
+		WHERE status = 'queued' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC
+		LIMIT 1`, now))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE messages SET status = 'sending', updated_at = ? WHERE id = ?", now, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	m.Status = StatusSending
+	return m, tx.Commit()
+}
+
+// Mark a message as delivered
+func MarkMessageSent(id string) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		UPDATE messages
+		SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = ?, updated_at = ?
+		WHERE id = ?`, now, now, id)
+	return err
+}
+
+// Record a failed attempt. The message is queued again for nextAttemptAt, or
+// marked as failed when giveUp is true.
+func MarkMessageAttemptFailed(id, lastError string, nextAttemptAt time.Time, giveUp bool) error {
+	status := StatusQueued
+	if giveUp {
+		status = StatusFailed
+	}
+	_, err := db.Exec(`
+		UPDATE messages
+		SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?`, status, lastError, nextAttemptAt.UTC(), time.Now().UTC(), id)
+	return err
+}
+
+// Queue a message again for nextAttemptAt without counting the attempt, for
+// failures that say nothing about the message itself
+func PostponeMessage(id, lastError string, nextAttemptAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE messages
+		SET status = 'queued', last_error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?`, lastError, nextAttemptAt.UTC(), time.Now().UTC(), id)
+	return err
+}
+
+// Queue again the messages left in sending by a previous run that stopped
+// before finishing them
+func RequeueInterruptedMessages() (int64, error) {
+	result, err := db.Exec("UPDATE messages SET status = 'queued', updated_at = ? WHERE status = 'sending'", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
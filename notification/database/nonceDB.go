@@ -0,0 +1,35 @@
+package database
+
+import (
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Record the nonce of a signed request, forgetting the expired ones. Returns
+// false when the nonce was already used with the same key.
+func UseNonce(keyID, nonce string, expiresAt time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM request_nonces WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec("INSERT OR IGNORE INTO request_nonces (key_id, nonce, expires_at) VALUES (?, ?, ?)",
+		keyID, nonce, expiresAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Reasons a recipient is suppressed
+const (
+	SuppressionBounced      = "bounced"
+	SuppressionUnsubscribed = "unsubscribed"
+	SuppressionComplaint    = "complaint"
+	SuppressionManual       = "manual"
+)
+
+// Recipient no message is sent to
+type Suppression struct {
+	Recipient string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// Common interface of *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Check whether a reason is one of the known ones
+func ValidSuppressionReason(reason string) bool {
+	switch reason {
+	case SuppressionBounced, SuppressionUnsubscribed, SuppressionComplaint, SuppressionManual:
+		return true
+	}
+	return false
+}
+
+// Helper function to get the suppression of a recipient, ignoring case.
+// Returns sql.ErrNoRows when the recipient is not suppressed.
+func getSuppression(q queryer, recipient string) (*Suppression, error) {
+	var s Suppression
+	err := q.QueryRow("SELECT recipient, reason, created_at FROM suppressions WHERE recipient = ?", recipient).
+		Scan(&s.Recipient, &s.Reason, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Get the suppression of a recipient. Returns sql.ErrNoRows when the
+// recipient is not suppressed.
+func GetSuppression(recipient string) (*Suppression, error) {
+	return getSuppression(db, recipient)
+}
+
+// Get all suppressed recipients, newest first
+func GetSuppressions() ([]Suppression, error) {
+	rows, err := db.Query("SELECT recipient, reason, created_at FROM suppressions ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppressions := []Suppression{}
+	for rows.Next() {
+		var s Suppression
+		if err := rows.Scan(&s.Recipient, &s.Reason, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		suppressions = append(suppressions, s)
+	}
+	return suppressions, rows.Err()
+}
+
+// Add a recipient to the suppression list, or change the reason it is there
+func AddSuppression(recipient, reason string) error {
+	_, err := db.Exec(`
+		INSERT INTO suppressions (recipient, reason, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(recipient) DO UPDATE SET reason = excluded.reason`,
+		recipient, reason, time.Now().UTC())
+	return err
+}
+
+// Remove a recipient from the suppression list. Returns sql.ErrNoRows when
+// the recipient was not suppressed.
+func RemoveSuppression(recipient string) error {
+	result, err := db.Exec("DELETE FROM suppressions WHERE recipient = ?", recipient)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"progetto/notification/database"
+	"progetto/notification/util"
+	"time"
+)
+
+// Largest body accepted from a caller
+const maxRequestBody = 1 << 20
+
+type contextKey string
+
+// Key ID of the caller of a signed request, in the request context
+const callerKey contextKey = "caller"
+
+// Helper function to get the key ID of the caller of a request
+func callerFromContext(r *http.Request) string {
+	caller, _ := r.Context().Value(callerKey).(string)
+	return caller
+}
+
+// Helper function to check the signature of a request and that its nonce was
+// never used before
+func verifyRequest(r *http.Request, body []byte) error {
+	keyID := r.Header.Get(util.HeaderSignatureKey)
+	timestamp := r.Header.Get(util.HeaderSignatureTimestamp)
+	nonce := r.Header.Get(util.HeaderSignatureNonce)
+	signature := r.Header.Get(util.HeaderSignature)
+	if keyID == "" || signature == "" {
+		return fmt.Errorf("%w: request is not signed", util.ErrInvalidSignature)
+	}
+
+	base := util.SignatureBase(r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if err := util.VerifySignature(keyID, timestamp, nonce, signature, base, time.Now()); err != nil {
+		return err
+	}
+
+	fresh, err := database.UseNonce(keyID, nonce, time.Now().Add(2*util.MaxSignatureAge))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return fmt.Errorf("%w: nonce %q already used", util.ErrReplayedRequest, nonce)
+	}
+	return nil
+}
+
+// Middleware rejecting the requests that are not signed with one of the
+// configured keys, or that replay an earlier request
+func RequireSignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = verifyRequest(r, body)
+		if errors.Is(err, util.ErrInvalidSignature) || errors.Is(err, util.ErrReplayedRequest) {
+			slog.WarnContext(r.Context(), "Request rejected", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error verifying request", "error", err)
+			http.Error(w, "Error verifying request", http.StatusInternalServerError)
+			return
+		}
+
+		// the handler reads the body again
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ctx := context.WithValue(r.Context(), callerKey, r.Header.Get(util.HeaderSignatureKey))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"progetto/notification/database"
+	"time"
+)
+
+// Longest time the readiness check waits for the database
+const readinessTimeout = 2 * time.Second
+
+// Outcome of the health and readiness checks
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health Handler - The process is up and serving requests
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Readiness Handler - The database answers, so messages can be accepted
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := database.PingDatabase(ctx); err != nil {
+		slog.WarnContext(r.Context(), "Readiness check failed", "check", "database", "error", err)
+		respondJSON(w, http.StatusServiceUnavailable, HealthStatus{
+			Status: "unavailable",
+			Checks: map[string]string{"database": err.Error()},
+		})
+		return
+	}
+	respondJSON(w, http.StatusOK, HealthStatus{Status: "ok", Checks: map[string]string{"database": "ok"}})
+}
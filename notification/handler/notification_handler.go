@@ -1,32 +1,235 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"progetto/logging"
+	"progetto/notification/database"
+	"progetto/notification/queue"
 	"progetto/notification/util"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
+// Message to deliver: either a template with its data, or a subject and a
+// free-text message
 type Notification struct {
-	Recipient string `json:"recipient"`
-	Subject   string `json:"subject"`
-	Body      string `json:"message"`
+	// Delivery channel, email when empty
+	Channel   string         `json:"channel"`
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data"`
+	Subject   string         `json:"subject"`
+	Body      string         `json:"message"`
+	// Event attached as an .ics file to emails
+	Calendar *util.CalendarEvent `json:"calendar"`
+}
+
+// Delivery status of a queued message
+type NotificationStatus struct {
+	ID            string     `json:"id"`
+	Channel       string     `json:"channel"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template,omitempty"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// Error codes of the refused messages, so callers can tell them apart
+// without parsing the message
+const (
+	errCodeInvalidRequest       = "invalid_request"
+	errCodeChannelUnavailable   = "channel_unavailable"
+	errCodeInvalidRecipient     = "invalid_recipient"
+	errCodeUnknownTemplate      = "unknown_template"
+	errCodeTemplateError        = "template_error"
+	errCodeInvalidCalendar      = "invalid_calendar"
+	errCodeInternal             = "internal_error"
+	errCodeCallerRateLimited    = "caller_rate_limited"
+	errCodeRecipientRateLimited = "recipient_rate_limited"
+	errCodeRecipientSuppressed  = "recipient_suppressed"
+)
+
+// Limits on the messages accepted from the callers
+var rateLimits = database.RateLimits{CallerPerMinute: 60, RecipientPerHour: 10}
+
+// Override the default rate limits
+func SetRateLimits(limits database.RateLimits) {
+	rateLimits = limits
+}
+
+// Error returned to the caller with its code
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Helper function to write a JSON response
+func respondJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding response", "error", err)
+	}
 }
 
+// Helper function to write an error response with its code
+func respondError(w http.ResponseWriter, status int, code, message string) {
+	respondJSON(w, status, ErrorResponse{Error: code, Message: message})
+}
+
+func toNotificationStatus(m *database.Message) NotificationStatus {
+	status := NotificationStatus{
+		ID:        m.ID,
+		Channel:   m.Channel,
+		Recipient: m.Recipient,
+		Template:  m.Template,
+		Subject:   m.Subject,
+		Status:    m.Status,
+		Attempts:  m.Attempts,
+		LastError: m.LastError,
+		CreatedAt: m.CreatedAt,
+		SentAt:    m.SentAt,
+	}
+	if m.Status == database.StatusQueued {
+		status.NextAttemptAt = &m.NextAttemptAt
+	}
+	return status
+}
+
+// Notification Handler - Queue a message and return its ID without waiting
+// for the delivery
 func NotificationHandler(w http.ResponseWriter, r *http.Request) {
 	var notif Notification
 
 	if err := json.NewDecoder(r.Body).Decode(&notif); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		respondError(w, http.StatusBadRequest, errCodeInvalidRequest, "Invalid input")
+		return
+	}
+
+	if notif.Recipient == "" {
+		respondError(w, http.StatusBadRequest, errCodeInvalidRequest, "Missing required fields")
+		return
+	}
+	if notif.Template != "" && (notif.Subject != "" || notif.Body != "") {
+		respondError(w, http.StatusBadRequest, errCodeInvalidRequest, "Use either a template or a subject and message")
+		return
+	}
+	if notif.Template == "" && (notif.Subject == "" || notif.Body == "") {
+		respondError(w, http.StatusBadRequest, errCodeInvalidRequest, "Missing required fields")
 		return
 	}
 
-	if notif.Recipient == "" || notif.Subject == "" || notif.Body == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	if notif.Channel == "" {
+		notif.Channel = util.ChannelEmail
+	}
+
+	sender, err := util.GetSender(notif.Channel)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, errCodeChannelUnavailable, "Unknown or disabled channel")
 		return
 	}
 
-	util.SendEmail(notif.Recipient, notif.Subject, notif.Body)
+	if err := sender.ValidateRecipient(notif.Recipient); err != nil {
+		respondError(w, http.StatusUnprocessableEntity, errCodeInvalidRecipient, "Invalid recipient")
+		return
+	}
+
+	m := &database.Message{
+		Caller:    callerFromContext(r),
+		Channel:   notif.Channel,
+		Recipient: notif.Recipient,
+		Template:  notif.Template,
+		Subject:   notif.Subject,
+		Body:      notif.Body,
+		RequestID: logging.RequestID(r.Context()),
+	}
+
+	// render now, so a bad template or missing data is reported to the caller
+	// instead of failing every delivery attempt
+	if notif.Template != "" {
+		rendered, err := util.RenderTemplate(notif.Template, notif.Data)
+		if errors.Is(err, util.ErrUnknownTemplate) {
+			respondError(w, http.StatusUnprocessableEntity, errCodeUnknownTemplate, "Unknown template")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering template", "template", notif.Template, "error", err)
+			respondError(w, http.StatusUnprocessableEntity, errCodeTemplateError, "Error rendering template: "+err.Error())
+			return
+		}
+		m.Subject, m.Body, m.HTMLBody = rendered.Subject, rendered.Text, rendered.HTML
+	}
+
+	if notif.Calendar != nil {
+		if err := notif.Calendar.Validate(); err != nil {
+			respondError(w, http.StatusUnprocessableEntity, errCodeInvalidCalendar, "Invalid calendar event")
+			return
+		}
+		calendar, err := json.Marshal(notif.Calendar)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding calendar event", "error", err)
+			respondError(w, http.StatusInternalServerError, errCodeInternal, "Error queuing message")
+			return
+		}
+		m.Calendar = string(calendar)
+	}
+
+	err = database.InsertMessage(m, rateLimits)
+	switch {
+	case errors.Is(err, database.ErrRecipientSuppressed):
+		suppression, _ := database.GetSuppression(m.Recipient)
+		message := "Recipient is in the suppression list"
+		if suppression != nil {
+			message += " (" + suppression.Reason + ")"
+		}
+		respondError(w, http.StatusUnprocessableEntity, errCodeRecipientSuppressed, message)
+		return
+	case errors.Is(err, database.ErrCallerRateLimited):
+		slog.WarnContext(r.Context(), "Caller over its rate limit", "caller", m.Caller)
+		w.Header().Set("Retry-After", "60")
+		respondError(w, http.StatusTooManyRequests, errCodeCallerRateLimited, "Too many messages from this caller, retry later")
+		return
+	case errors.Is(err, database.ErrRecipientRateLimited):
+		slog.WarnContext(r.Context(), "Recipient over its rate limit", "recipient", m.Recipient)
+		w.Header().Set("Retry-After", "3600")
+		respondError(w, http.StatusTooManyRequests, errCodeRecipientRateLimited, "Too many messages to this recipient, retry later")
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Error queuing message", "error", err)
+		respondError(w, http.StatusInternalServerError, errCodeInternal, "Error queuing message")
+		return
+	}
+	queue.Notify()
+
+	slog.InfoContext(r.Context(), "Message queued", "message_id", m.ID, "recipient", m.Recipient, "channel", m.Channel)
+	w.Header().Set("Location", "/notification/"+m.ID)
+	respondJSON(w, http.StatusAccepted, map[string]string{"id": m.ID, "status": m.Status})
+}
+
+// Notification Status Handler - Delivery status of a queued message
+func NotificationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	m, err := database.GetMessage(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting message", "message_id", id, "error", err)
+		http.Error(w, "Error retrieving message", http.StatusInternalServerError)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Email sent successfully"))
+	respondJSON(w, http.StatusOK, toNotificationStatus(m))
 }
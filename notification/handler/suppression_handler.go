@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"progetto/notification/database"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Recipient in the suppression list
+type SuppressionEntry struct {
+	Recipient string    `json:"recipient"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Suppressions Handler - Recipients no message is sent to
+func SuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	suppressions, err := database.GetSuppressions()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing suppressions", "error", err)
+		http.Error(w, "Error listing suppressions", http.StatusInternalServerError)
+		return
+	}
+
+	entries := []SuppressionEntry{}
+	for _, s := range suppressions {
+		entries = append(entries, SuppressionEntry{Recipient: s.Recipient, Reason: s.Reason, CreatedAt: s.CreatedAt})
+	}
+	respondJSON(w, http.StatusOK, map[string][]SuppressionEntry{"suppressions": entries})
+}
+
+// Suppress Handler - Add a recipient to the suppression list, e.g. after an
+// unsubscribe request or a complaint
+func SuppressHandler(w http.ResponseWriter, r *http.Request) {
+	recipient := strings.TrimSpace(mux.Vars(r)["recipient"])
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = database.SuppressionManual
+	}
+	if !database.ValidSuppressionReason(req.Reason) {
+		http.Error(w, "Invalid reason", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := database.AddSuppression(recipient, req.Reason); err != nil {
+		slog.ErrorContext(r.Context(), "Error suppressing recipient", "recipient", recipient, "error", err)
+		http.Error(w, "Error saving suppression", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Recipient suppressed", "recipient", recipient, "caller", callerFromContext(r), "reason", req.Reason)
+	suppression, err := database.GetSuppression(recipient)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting suppression", "recipient", recipient, "error", err)
+		http.Error(w, "Error saving suppression", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, SuppressionEntry{Recipient: suppression.Recipient, Reason: suppression.Reason, CreatedAt: suppression.CreatedAt})
+}
+
+// Unsuppress Handler - Remove a recipient from the suppression list
+func UnsuppressHandler(w http.ResponseWriter, r *http.Request) {
+	recipient := strings.TrimSpace(mux.Vars(r)["recipient"])
+
+	err := database.RemoveSuppression(recipient)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Recipient not suppressed", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error removing suppression", "recipient", recipient, "error", err)
+		http.Error(w, "Error removing suppression", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Recipient removed from the suppression list", "recipient", recipient, "caller", callerFromContext(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"progetto/notification/util"
+
+	"github.com/gorilla/mux"
+)
+
+// Templates Handler - Names of the available templates
+func TemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	names, err := util.ListTemplates()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing templates", "error", err)
+		http.Error(w, "Error listing templates", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string][]string{"templates": names})
+}
+
+// Template Handler - Source of a template
+func TemplateHandler(w http.ResponseWriter, r *http.Request) {
+	source, err := util.GetTemplate(mux.Vars(r)["name"])
+	if errors.Is(err, util.ErrUnknownTemplate) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error reading template", "error", err)
+		http.Error(w, "Error reading template", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, source)
+}
+
+// Save Template Handler - Create or replace a template
+func SaveTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var source util.TemplateSource
+
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	source.Name = mux.Vars(r)["name"]
+
+	err := util.SaveTemplate(&source)
+	if errors.Is(err, util.ErrInvalidTemplate) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving template", "template", source.Name, "error", err)
+		http.Error(w, "Error saving template", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Template saved", "template", source.Name)
+	respondJSON(w, http.StatusOK, source)
+}
@@ -1,20 +1,153 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"progetto/logging"
+	"progetto/notification/config"
+	"progetto/notification/database"
 	"progetto/notification/handler"
+	"progetto/notification/metrics"
+	"progetto/notification/queue"
+	"progetto/notification/util"
+	"sync"
+	"syscall"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// load the configuration: defaults, then file, environment and flags
+	cfg, printOnly, err := config.Load(config.Default(), os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if printOnly {
+		return
+	}
+
+	// structured logs from here on
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		log.Fatalf("Error configuring logs: %v", err)
+	}
+
+	// enable the channels before accepting any message
+	err = util.LoadSenders(util.SenderConfig{
+		SMTP: util.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Email:    cfg.SMTP.Email,
+			Password: cfg.SMTP.Password,
+		},
+		WebhookURL:    cfg.Webhook.URL,
+		SMSGatewayURL: cfg.SMS.GatewayURL,
+		SMSToken:      cfg.SMS.Token,
+		SMSSender:     cfg.SMS.Sender,
+		LogSink:       cfg.LogSink,
+	})
+	if err != nil {
+		logging.Fatal("Invalid configuration", "error", err)
+	}
+	slog.Info("Delivery channels enabled", "channels", util.Channels())
+
+	// every caller must sign its requests with one of these keys
+	util.SetSigningKeys(cfg.SigningKeys)
+	slog.Info("Signing keys accepted", "keys", util.SigningKeyIDs())
+
+	if err := util.LoadTemplates(cfg.Templates.Dir); err != nil {
+		logging.Fatal("Invalid templates", "error", err)
+	}
+
+	database.InitDatabase(cfg.Database.Path)
+	slog.Info("Database initialized", "path", cfg.Database.Path)
+
+	// stop on SIGINT or SIGTERM: the requests in flight are drained and the
+	// workers finish the messages they are delivering
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
+	// limits against floods of messages, from a caller or to a recipient, and
+	// on the total sent every hour
+	handler.SetRateLimits(database.RateLimits{
+		CallerPerMinute:  cfg.Limits.CallerPerMinute,
+		RecipientPerHour: cfg.Limits.RecipientPerHour,
+	})
+	queue.SetHourlyQuota(cfg.Queue.HourlyQuota)
+
+	// deliver queued messages in the background
+	queue.Start(ctx, &background, cfg.Queue.Workers)
 
 	r := mux.NewRouter()
 
-	r.HandleFunc("/notification", handler.NotificationHandler).Methods("POST")
+	// every request gets an ID, taken from the caller when it sends one
+	r.Use(logging.Middleware)
+	// and its latency is recorded by route
+	r.Use(metrics.Middleware)
+
+	// Liveness and readiness probes, not signed
+	r.HandleFunc("/healthz", handler.HealthHandler).Methods("GET")
+	r.HandleFunc("/readyz", handler.ReadinessHandler).Methods("GET")
+
+	// Prometheus metrics, not signed either
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	api := r.NewRoute().Subrouter()
+	api.Use(handler.RequireSignature)
+
+	api.HandleFunc("/notification", handler.NotificationHandler).Methods("POST")
+	api.HandleFunc("/notification/{id}", handler.NotificationStatusHandler).Methods("GET")
+	api.HandleFunc("/templates", handler.TemplatesHandler).Methods("GET")
+	api.HandleFunc("/templates/{name}", handler.TemplateHandler).Methods("GET")
+	api.HandleFunc("/templates/{name}", handler.SaveTemplateHandler).Methods("PUT")
+	api.HandleFunc("/suppressions", handler.SuppressionsHandler).Methods("GET")
+	api.HandleFunc("/suppressions/{recipient}", handler.SuppressHandler).Methods("PUT")
+	api.HandleFunc("/suppressions/{recipient}", handler.UnsuppressHandler).Methods("DELETE")
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Notification microservice listening", "addr", cfg.Server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	failed := false
+	select {
+	case err := <-serverErr:
+		slog.Error("Server failed", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("Shutting down, draining requests in flight")
+	}
+	stop()
 
-	log.Println("Notification microservice listening on :8081...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+	background.Wait()
 
-	log.Fatal(http.ListenAndServe(":8081", r))
+	database.CloseDatabase()
+	slog.Info("Notification microservice stopped")
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of a delivery attempt
+const (
+	DeliverySent   = "sent"
+	DeliveryRetry  = "retry"
+	DeliveryFailed = "failed"
+)
+
+var (
+	// Latency of the HTTP requests, by route template rather than by path so
+	// that message IDs and recipients do not multiply the series
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Delivery attempts of the queued messages
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notification_deliveries_total",
+		Help: "Delivery attempts by channel and outcome (sent, retry, failed).",
+	}, []string{"channel", "outcome"})
+)
+
+// Count the outcome of a delivery attempt
+func Delivery(channel, outcome string) {
+	deliveries.WithLabelValues(channel, outcome).Inc()
+}
+
+// Handler exposing the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Response writer remembering the status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware recording the latency of every request matched by the router
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpDuration.WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
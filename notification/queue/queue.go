@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"progetto/logging"
+	"progetto/notification/database"
+	"progetto/notification/metrics"
+	"progetto/notification/util"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Attempts before a message is marked as failed
+	maxAttempts = 6
+	// Delay before the first retry, doubled at every failed attempt
+	baseRetryDelay = 10 * time.Second
+	// Longest delay between two attempts
+	maxRetryDelay = 10 * time.Minute
+	// How often idle workers look for messages whose retry is due
+	pollInterval = 5 * time.Second
+)
+
+// Wakes up an idle worker when a new message is queued
+var wake = make(chan struct{}, 1)
+
+// Messages that can be sent in an hour, over every channel; zero disables
+// the quota. Messages over the quota wait in the queue.
+var hourlyQuota = 0
+
+// Set while the quota is reached, so the pause is logged once
+var quotaReached atomic.Bool
+
+// Set the hourly quota of sent messages
+func SetHourlyQuota(quota int) {
+	hourlyQuota = quota
+}
+
+// Tell the workers that a new message is ready to be delivered
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Helper function to compute the delay before the next attempt, given the
+// number of attempts already made
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// Helper function to hand a stored message to its channel. Recipients
+// suppressed after the message was queued are not contacted.
+func send(m *database.Message) error {
+	sender, err := util.GetSender(m.Channel)
+	if err != nil {
+		return err
+	}
+
+	if suppression, err := database.GetSuppression(m.Recipient); err == nil {
+		return fmt.Errorf("%w: %s (%s)", util.ErrPermanentRecipient, database.ErrRecipientSuppressed, suppression.Reason)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: error checking suppression list: %v", util.ErrTransient, err)
+	}
+
+	message := util.Message{
+		ID:        m.ID,
+		Recipient: m.Recipient,
+		Subject:   m.Subject,
+		Body:      m.Body,
+		HTMLBody:  m.HTMLBody,
+	}
+	if m.Calendar != "" {
+		message.Calendar = &util.CalendarEvent{}
+		if err := json.Unmarshal([]byte(m.Calendar), message.Calendar); err != nil {
+			return fmt.Errorf("%w: invalid calendar event: %v", util.ErrPermanentRecipient, err)
+		}
+	}
+	return sender.Send(message)
+}
+
+// Deliver a claimed message and record the outcome
+func deliver(m *database.Message) {
+	// the logs of the delivery carry the ID of the request that queued the
+	// message
+	ctx := logging.WithRequestID(context.Background(), m.RequestID)
+
+	err := send(m)
+	if errors.Is(err, util.ErrBounced) {
+		// the mailbox does not exist: stop sending to it
+		if err := database.AddSuppression(m.Recipient, database.SuppressionBounced); err != nil {
+			slog.ErrorContext(ctx, "Error suppressing recipient", "recipient", m.Recipient, "error", err)
+		} else {
+			slog.InfoContext(ctx, "Recipient suppressed after a bounce", "recipient", m.Recipient)
+		}
+	}
+	if err == nil {
+		if err := database.MarkMessageSent(m.ID); err != nil {
+			slog.ErrorContext(ctx, "Error marking message as sent", "message_id", m.ID, "error", err)
+		}
+		slog.InfoContext(ctx, "Message sent", "message_id", m.ID, "recipient", m.Recipient, "channel", m.Channel)
+		metrics.Delivery(m.Channel, metrics.DeliverySent)
+		return
+	}
+
+	if errors.Is(err, util.ErrConfig) {
+		// nothing can be sent until the configuration is fixed, e.g. after a
+		// password or token rotation: keep the message without counting the
+		// attempt and try again at the longest delay
+		nextAttemptAt := time.Now().Add(maxRetryDelay)
+		if err := database.PostponeMessage(m.ID, err.Error(), nextAttemptAt); err != nil {
+			slog.ErrorContext(ctx, "Error postponing message", "message_id", m.ID, "error", err)
+		}
+		metrics.Delivery(m.Channel, metrics.DeliveryRetry)
+		slog.ErrorContext(ctx, "Message held by a configuration error",
+			"message_id", m.ID, "recipient", m.Recipient, "channel", m.Channel, "retry_at", nextAttemptAt, "error", err)
+		return
+	}
+
+	attempts := m.Attempts + 1
+	// only transient failures are worth another attempt
+	giveUp := attempts >= maxAttempts || !errors.Is(err, util.ErrTransient)
+	nextAttemptAt := time.Now().Add(retryDelay(attempts))
+	if err := database.MarkMessageAttemptFailed(m.ID, err.Error(), nextAttemptAt, giveUp); err != nil {
+		slog.ErrorContext(ctx, "Error recording failed message", "message_id", m.ID, "error", err)
+	}
+
+	if giveUp {
+		metrics.Delivery(m.Channel, metrics.DeliveryFailed)
+		slog.ErrorContext(ctx, "Message failed, giving up", "message_id", m.ID, "recipient", m.Recipient, "channel", m.Channel, "attempts", attempts, "error", err)
+	} else {
+		metrics.Delivery(m.Channel, metrics.DeliveryRetry)
+		slog.WarnContext(ctx, "Message failed, retrying",
+			"message_id", m.ID, "recipient", m.Recipient, "channel", m.Channel, "attempts", attempts, "retry_at", nextAttemptAt, "error", err)
+	}
+}
+
+// Deliver messages until none is due, then wait for a new one or for the
+// next poll
+func worker(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			m, err := database.ClaimNextMessage(hourlyQuota)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if errors.Is(err, database.ErrQuotaExceeded) {
+				if !quotaReached.Swap(true) {
+					slog.WarnContext(ctx, "Hourly quota reached, delivery paused", "quota", hourlyQuota)
+				}
+				break
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error claiming message", "error", err)
+				break
+			}
+			if quotaReached.Swap(false) {
+				slog.InfoContext(ctx, "Delivery resumed")
+			}
+			deliver(m)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start the worker pool until the context is canceled. Messages left
+// half-sent by a previous run are queued again first. wg is done when every
+// worker has finished the message it was delivering.
+func Start(ctx context.Context, wg *sync.WaitGroup, workers int) {
+	n, err := database.RequeueInterruptedMessages()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error requeuing interrupted messages", "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "Interrupted messages queued again", "count", n)
+	}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(ctx)
+		}()
+	}
+}
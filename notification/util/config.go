@@ -0,0 +1,54 @@
+package util
+
+import "fmt"
+
+// Settings of the delivery channels. Each channel is enabled only when it is
+// configured:
+//   - email: SMTP, enabled by SMTP.Host
+//   - webhook: WebhookURL
+//   - sms: SMSGatewayURL, SMSToken and optionally SMSSender
+//   - log: LogSink, either "stdout" or the path of a file
+type SenderConfig struct {
+	SMTP          SMTPConfig
+	WebhookURL    string
+	SMSGatewayURL string
+	SMSToken      string
+	SMSSender     string
+	LogSink       string
+}
+
+// Enable the channels that are configured. At least one channel is required.
+func LoadSenders(cfg SenderConfig) error {
+	if cfg.SMTP.Host != "" {
+		RegisterSender(ChannelEmail, NewSMTPSender(cfg.SMTP))
+	}
+
+	if cfg.WebhookURL != "" {
+		webhook, err := NewWebhookSender(cfg.WebhookURL)
+		if err != nil {
+			return err
+		}
+		RegisterSender(ChannelWebhook, webhook)
+	}
+
+	if cfg.SMSGatewayURL != "" {
+		sms, err := NewSMSSender(cfg.SMSGatewayURL, cfg.SMSToken, cfg.SMSSender)
+		if err != nil {
+			return err
+		}
+		RegisterSender(ChannelSMS, sms)
+	}
+
+	if cfg.LogSink != "" {
+		sink, err := NewLogSender(cfg.LogSink)
+		if err != nil {
+			return err
+		}
+		RegisterSender(ChannelLog, sink)
+	}
+
+	if len(senders) == 0 {
+		return fmt.Errorf("%w: no delivery channel is configured", ErrConfig)
+	}
+	return nil
+}
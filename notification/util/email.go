@@ -2,46 +2,77 @@ package util
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"io"
+	"net/mail"
+	"time"
 
-	"github.com/joho/godotenv"
 	"gopkg.in/gomail.v2"
 )
 
-func SendEmail(recipient string, subject string, body string) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading the .env file: %v", err)
+// SMTP server used to send the emails, checked by the configuration at
+// startup
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Email    string
+	Password string
+}
+
+// SMTPSender delivers messages by email
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	return &SMTPSender{config: config}
+}
+
+// Check that a recipient is a valid email address
+func (s *SMTPSender) ValidateRecipient(recipient string) error {
+	if _, err := mail.ParseAddress(recipient); err != nil {
+		return fmt.Errorf("%w: invalid address %q: %v", ErrPermanentRecipient, recipient, err)
 	}
+	return nil
+}
 
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpEmail := os.Getenv("SMTP_EMAIL")
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
+// Send an email
+func (s *SMTPSender) Send(m Message) error {
+	if err := s.ValidateRecipient(m.Recipient); err != nil {
+		return err
+	}
 
-	if smtpHost == "" || smtpPort == "" || smtpEmail == "" || smtpPassword == "" {
-		log.Fatal("One or more SMTP variables are not defined in the .env file")
+	message := gomail.NewMessage()
+	message.SetHeader("From", s.config.Email)
+	message.SetHeader("To", m.Recipient)
+	message.SetHeader("Subject", m.Subject)
+	message.SetBody("text/plain", m.Body)
+	if m.HTMLBody != "" {
+		message.AddAlternative("text/html", m.HTMLBody)
 	}
+	if m.Calendar != nil {
+		ics := m.Calendar.ICS(s.config.Email, m.Recipient, time.Now())
+		message.Attach(m.Calendar.FileName(),
+			gomail.SetHeader(map[string][]string{
+				"Content-Type": {"text/calendar; charset=utf-8; method=" + m.Calendar.Method()},
+			}),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := io.WriteString(w, ics)
+				return err
+			}))
+	}
+
+	dialer := gomail.NewDialer(s.config.Host, s.config.Port, s.config.Email, s.config.Password)
 
-	port, err := strconv.Atoi(smtpPort)
+	sender, err := dialer.Dial()
 	if err != nil {
-		log.Fatalf("Error converting the SMTP port: %v", err)
+		return classifySMTPError(err)
 	}
+	defer sender.Close()
 
-	message := gomail.NewMessage()
-	message.SetHeader("From", smtpEmail)
-	message.SetHeader("To", recipient)
-	message.SetHeader("Subject", subject)
-	message.SetBody("text/plain", body)
-
-	dialer := gomail.NewDialer(smtpHost, port, smtpEmail, smtpPassword)
-
-	if err := dialer.DialAndSend(message); err != nil {
-		fmt.Println("Error sending the email:", err)
-		panic(err)
-	} else {
-		fmt.Println("Email sent successfully!")
+	// Send directly instead of gomail.Send, which flattens the SMTP reply
+	// into a string and loses its code
+	if err := sender.Send(s.config.Email, []string{m.Recipient}, message); err != nil {
+		return classifySMTPError(err)
 	}
+	return nil
 }
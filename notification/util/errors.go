@@ -0,0 +1,43 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+// Categories of delivery errors. Every error returned by SendEmail wraps one
+// of them, so callers can tell with errors.Is whether retrying makes sense.
+var (
+	// The service is misconfigured, e.g. missing SMTP settings or rejected
+	// credentials: no message can be sent until the configuration is fixed
+	ErrConfig = errors.New("configuration error")
+	// The SMTP server is unreachable or temporarily refused the message:
+	// the same message may be delivered by a later attempt
+	ErrTransient = errors.New("transient delivery failure")
+	// The recipient was refused or is not a valid address: retrying would
+	// fail again
+	ErrPermanentRecipient = errors.New("permanent recipient failure")
+	// The mailbox of the recipient does not exist or does not accept mail.
+	// Always wrapped together with ErrPermanentRecipient.
+	ErrBounced = errors.New("recipient mailbox unavailable")
+)
+
+// Helper function to wrap an SMTP error in its category. Authentication
+// failures are configuration errors, the other 5xx replies are permanent and
+// anything else (4xx replies, network errors) is transient. Replies saying
+// that the mailbox is unavailable (550, 551, 553) are also bounces.
+func classifySMTPError(err error) error {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		switch {
+		case smtpErr.Code == 530 || smtpErr.Code == 534 || smtpErr.Code == 535:
+			return fmt.Errorf("%w: %v", ErrConfig, err)
+		case smtpErr.Code == 550 || smtpErr.Code == 551 || smtpErr.Code == 553:
+			return fmt.Errorf("%w: %w: %v", ErrPermanentRecipient, ErrBounced, err)
+		case smtpErr.Code >= 500:
+			return fmt.Errorf("%w: %v", ErrPermanentRecipient, err)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrTransient, err)
+}
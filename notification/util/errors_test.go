@@ -0,0 +1,38 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"net/textproto"
+	"testing"
+)
+
+func TestClassifySMTPError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want []error
+	}{
+		{&textproto.Error{Code: 530, Msg: "Authentication required"}, []error{ErrConfig}},
+		{&textproto.Error{Code: 535, Msg: "Authentication credentials invalid"}, []error{ErrConfig}},
+		{&textproto.Error{Code: 550, Msg: "Mailbox unavailable"}, []error{ErrPermanentRecipient, ErrBounced}},
+		{&textproto.Error{Code: 551, Msg: "User not local"}, []error{ErrPermanentRecipient, ErrBounced}},
+		{&textproto.Error{Code: 553, Msg: "Mailbox name not allowed"}, []error{ErrPermanentRecipient, ErrBounced}},
+		{&textproto.Error{Code: 554, Msg: "Transaction failed"}, []error{ErrPermanentRecipient}},
+		{&textproto.Error{Code: 421, Msg: "Service not available"}, []error{ErrTransient}},
+		{&textproto.Error{Code: 452, Msg: "Insufficient storage"}, []error{ErrTransient}},
+		{io.ErrUnexpectedEOF, []error{ErrTransient}}, // connection dropped
+	}
+	categories := []error{ErrConfig, ErrTransient, ErrPermanentRecipient, ErrBounced}
+	for _, tt := range tests {
+		err := classifySMTPError(tt.err)
+		for _, category := range categories {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == category
+			}
+			if got := errors.Is(err, category); got != want {
+				t.Errorf("classifySMTPError(%v): errors.Is(%v) = %t, want %t", tt.err, category, got, want)
+			}
+		}
+	}
+}
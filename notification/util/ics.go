@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar event attached to an email as an iCalendar (.ics) file
+type CalendarEvent struct {
+	// Stable identifier of the event: a cancellation or an update must use
+	// the UID of the original invitation
+	UID             string    `json:"uid"`
+	Start           time.Time `json:"start"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Summary         string    `json:"summary"`
+	Description     string    `json:"description"`
+	Location        string    `json:"location"`
+	// Send a cancellation instead of an invitation
+	Cancelled bool `json:"cancelled"`
+}
+
+const icsTimeFormat = "20060102T150405Z"
+
+// Check the fields required to build the calendar file
+func (e *CalendarEvent) Validate() error {
+	if e.UID == "" || e.Start.IsZero() || e.Summary == "" {
+		return fmt.Errorf("%w: calendar event needs uid, start and summary", ErrPermanentRecipient)
+	}
+	if e.DurationMinutes <= 0 {
+		return fmt.Errorf("%w: calendar event needs a positive duration", ErrPermanentRecipient)
+	}
+	return nil
+}
+
+// iTIP method of the calendar file
+func (e *CalendarEvent) Method() string {
+	if e.Cancelled {
+		return "CANCEL"
+	}
+	return "REQUEST"
+}
+
+// Name of the attached file
+func (e *CalendarEvent) FileName() string {
+	if e.Cancelled {
+		return "annullamento.ics"
+	}
+	return "prenotazione.ics"
+}
+
+// Helper function to escape a text value
+func icsEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// Helper function to fold a content line at 75 octets, without splitting a
+// multi-byte character
+func icsFold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// Build the .ics file of the event, sent by organizer to attendee. The
+// sequence grows with the time the file is built, so calendars apply an
+// update or cancellation over the previous invitation.
+func (e *CalendarEvent) ICS(organizer, attendee string, now time.Time) string {
+	status, partstat := "CONFIRMED", "ACCEPTED"
+	if e.Cancelled {
+		status, partstat = "CANCELLED", "DECLINED"
+	}
+	end := e.Start.Add(time.Duration(e.DurationMinutes) * time.Minute)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Crisbi's//Notification Service//IT",
+		"CALSCALE:GREGORIAN",
+		"METHOD:" + e.Method(),
+		"BEGIN:VEVENT",
+		"UID:" + icsEscape(e.UID),
+		fmt.Sprintf("SEQUENCE:%d", now.Unix()),
+		"DTSTAMP:" + now.UTC().Format(icsTimeFormat),
+		"DTSTART:" + e.Start.UTC().Format(icsTimeFormat),
+		"DTEND:" + end.UTC().Format(icsTimeFormat),
+		"SUMMARY:" + icsEscape(e.Summary),
+		"STATUS:" + status,
+		"ORGANIZER:mailto:" + organizer,
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=" + partstat + ":mailto:" + attendee,
+	}
+	if e.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+icsEscape(e.Description))
+	}
+	if e.Location != "" {
+		lines = append(lines, "LOCATION:"+icsEscape(e.Location))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(icsFold(line))
+	}
+	return b.String()
+}
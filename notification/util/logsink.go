@@ -0,0 +1,55 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogSender writes the messages to a file or to stdout instead of sending
+// them, for development
+type LogSender struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Open the sink: "stdout" writes to the standard output, anything else is
+// the path of a file the messages are appended to
+func NewLogSender(target string) (*LogSender, error) {
+	if target == "stdout" {
+		return &LogSender{out: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error opening log sink: %v", ErrConfig, err)
+	}
+	return &LogSender{out: file}, nil
+}
+
+// Any recipient is accepted
+func (s *LogSender) ValidateRecipient(recipient string) error {
+	return nil
+}
+
+// Write the message to the sink
+func (s *LogSender) Send(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.out, "----- %s\nID: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), m.ID, m.Recipient, m.Subject, m.Body)
+	if err == nil && m.HTMLBody != "" {
+		_, err = fmt.Fprintf(s.out, "--- HTML\n%s\n\n", m.HTMLBody)
+	}
+	if err == nil && m.Calendar != nil {
+		_, err = fmt.Fprintf(s.out, "--- %s\n%s\n", m.Calendar.FileName(),
+			m.Calendar.ICS("organizer@localhost", m.Recipient, time.Now()))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: error writing to log sink: %v", ErrTransient, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Delivery channels
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelLog     = "log"
+)
+
+// Message handed to a channel for delivery
+type Message struct {
+	ID        string
+	Recipient string
+	Subject   string
+	Body      string
+	// HTML alternative of Body, empty for text-only messages
+	HTMLBody string
+	// Event attached as an .ics file by the channels that support it
+	Calendar *CalendarEvent
+}
+
+// Sender delivers messages over one channel. Errors returned by Send wrap
+// ErrConfig, ErrTransient or ErrPermanentRecipient.
+type Sender interface {
+	// Check that the recipient is an address this channel can deliver to
+	ValidateRecipient(recipient string) error
+	Send(m Message) error
+}
+
+var senders = map[string]Sender{}
+
+// Enable a channel
+func RegisterSender(channel string, s Sender) {
+	senders[channel] = s
+}
+
+// Get the sender of an enabled channel
+func GetSender(channel string) (Sender, error) {
+	s, ok := senders[channel]
+	if !ok {
+		return nil, fmt.Errorf("%w: channel %q is not enabled", ErrConfig, channel)
+	}
+	return s, nil
+}
+
+// Names of the enabled channels, sorted
+func Channels() []string {
+	var channels []string
+	for channel := range senders {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Phone numbers in international format, e.g. +393331234567
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SMSSender delivers messages through an HTTP SMS gateway. The gateway
+// receives a JSON body with the fields to, from and text, authenticated with
+// a bearer token.
+type SMSSender struct {
+	gatewayURL string
+	token      string
+	from       string
+}
+
+func NewSMSSender(gatewayURL, token, from string) (*SMSSender, error) {
+	if err := validateURL("SMS_GATEWAY_URL", gatewayURL); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: SMS_GATEWAY_TOKEN is not defined", ErrConfig)
+	}
+	return &SMSSender{gatewayURL: gatewayURL, token: token, from: from}, nil
+}
+
+// Check that a recipient is a phone number in international format
+func (s *SMSSender) ValidateRecipient(recipient string) error {
+	if !phonePattern.MatchString(recipient) {
+		return fmt.Errorf("%w: invalid phone number %q", ErrPermanentRecipient, recipient)
+	}
+	return nil
+}
+
+// Send the message as a text, with the subject on the first line
+func (s *SMSSender) Send(m Message) error {
+	if err := s.ValidateRecipient(m.Recipient); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+s.token)
+	return postJSON(s.gatewayURL, header, map[string]string{
+		"to":   m.Recipient,
+		"from": s.from,
+		"text": m.Subject + "\n\n" + m.Body,
+	})
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSMSSenderSend(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusUnauthorized, ErrConfig},                    // wrong token
+		{http.StatusUnprocessableEntity, ErrPermanentRecipient}, // number refused
+		{http.StatusServiceUnavailable, ErrTransient},           // gateway down
+	}
+	for _, tt := range tests {
+		var body map[string]string
+		var authorization string
+		gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("decoding request body: %v", err)
+			}
+			w.WriteHeader(tt.status)
+		}))
+
+		sender, err := NewSMSSender(gateway.URL, "secret-token", "Crisbi")
+		if err != nil {
+			t.Fatalf("NewSMSSender: %v", err)
+		}
+		err = sender.Send(Message{Recipient: "+393331234567", Subject: "Prenotazione", Body: "Ti aspettiamo"})
+		gateway.Close()
+
+		if tt.want == nil && err != nil {
+			t.Errorf("status %d: Send returned %v, want nil", tt.status, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("status %d: Send returned %v, want %v", tt.status, err, tt.want)
+		}
+		if authorization != "Bearer secret-token" {
+			t.Errorf("status %d: Authorization = %q", tt.status, authorization)
+		}
+		if body["to"] != "+393331234567" || body["from"] != "Crisbi" || body["text"] != "Prenotazione\n\nTi aspettiamo" {
+			t.Errorf("status %d: unexpected body %v", tt.status, body)
+		}
+	}
+}
+
+func TestSMSSenderRejectsInvalidNumber(t *testing.T) {
+	sender, err := NewSMSSender("http://localhost:1", "secret-token", "")
+	if err != nil {
+		t.Fatalf("NewSMSSender: %v", err)
+	}
+	// the gateway is never contacted for a number that is not in international format
+	if err := sender.Send(Message{Recipient: "3331234567"}); !errors.Is(err, ErrPermanentRecipient) {
+		t.Errorf("Send returned %v, want %v", err, ErrPermanentRecipient)
+	}
+}
@@ -0,0 +1,224 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Every template is made of up to three files in the templates directory:
+//   - <name>.subject: the subject, required
+//   - <name>.txt: the text body, required, also used for SMS
+//   - <name>.html: the HTML body, optional
+//
+// The files are read again at every render, so they can be edited while the
+// service is running.
+const (
+	subjectExt = ".subject"
+	textExt    = ".txt"
+	htmlExt    = ".html"
+)
+
+var (
+	// Returned when no template has the requested name
+	ErrUnknownTemplate = errors.New("unknown template")
+	// Returned when a template does not parse or cannot be rendered with the
+	// given data
+	ErrInvalidTemplate = errors.New("invalid template")
+)
+
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var templatesDir = "./templates"
+
+// Source of a template, as stored in its files
+type TemplateSource struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Message rendered from a template
+type RenderedTemplate struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Set the templates directory and check that every template in it parses
+func LoadTemplates(dir string) error {
+	templatesDir = dir
+
+	names, err := ListTemplates()
+	if err != nil {
+		return fmt.Errorf("%w: error reading templates: %v", ErrConfig, err)
+	}
+	for _, name := range names {
+		source, err := GetTemplate(name)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrConfig, err)
+		}
+		if err := parseTemplate(source); err != nil {
+			return fmt.Errorf("%w: %v", ErrConfig, err)
+		}
+	}
+	return nil
+}
+
+// Names of the available templates, sorted
+func ListTemplates() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(templatesDir, "*"+subjectExt))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), subjectExt))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Helper function to read a template file, returning an empty string when an
+// optional file does not exist
+func readTemplateFile(name, ext string, required bool) (string, error) {
+	content, err := os.ReadFile(filepath.Join(templatesDir, name+ext))
+	if errors.Is(err, os.ErrNotExist) {
+		if required {
+			return "", fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+		}
+		return "", nil
+	}
+	return string(content), err
+}
+
+// Get the source of a template
+func GetTemplate(name string) (*TemplateSource, error) {
+	if !templateNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	source := &TemplateSource{Name: name}
+	var err error
+	if source.Subject, err = readTemplateFile(name, subjectExt, true); err != nil {
+		return nil, err
+	}
+	if source.Text, err = readTemplateFile(name, textExt, true); err != nil {
+		return nil, err
+	}
+	if source.HTML, err = readTemplateFile(name, htmlExt, false); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Helper function to parse every variant of a template. Missing keys in the
+// data are errors, so a typo in a template does not go out as "<no value>".
+func parseTemplates(source *TemplateSource) (*template.Template, *template.Template, *htmltemplate.Template, error) {
+	subject, err := template.New(source.Name + subjectExt).Option("missingkey=error").Parse(source.Subject)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	text, err := template.New(source.Name + textExt).Option("missingkey=error").Parse(source.Text)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	var html *htmltemplate.Template
+	if strings.TrimSpace(source.HTML) != "" {
+		html, err = htmltemplate.New(source.Name + htmlExt).Option("missingkey=error").Parse(source.HTML)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+	return subject, text, html, nil
+}
+
+// Helper function to check that a template parses
+func parseTemplate(source *TemplateSource) error {
+	_, _, _, err := parseTemplates(source)
+	return err
+}
+
+// Render a template with the given data
+func RenderTemplate(name string, data map[string]any) (*RenderedTemplate, error) {
+	source, err := GetTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, text, html, err := parseTemplates(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered RenderedTemplate
+	var buf bytes.Buffer
+	if err := subject.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	// the subject is a single line
+	rendered.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := text.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	rendered.Text = strings.TrimSpace(buf.String())
+
+	if html != nil {
+		buf.Reset()
+		if err := html.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		rendered.HTML = strings.TrimSpace(buf.String())
+	}
+
+	return &rendered, nil
+}
+
+// Helper function to write a file through a temporary one, so a render never
+// reads a half-written template
+func writeTemplateFile(name, ext, content string) error {
+	path := filepath.Join(templatesDir, name+ext)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Create or replace a template, after checking that it parses. An empty HTML
+// body removes the HTML variant.
+func SaveTemplate(source *TemplateSource) error {
+	if !templateNamePattern.MatchString(source.Name) {
+		return fmt.Errorf("%w: name must only contain lowercase letters, digits and underscores", ErrInvalidTemplate)
+	}
+	if strings.TrimSpace(source.Subject) == "" || strings.TrimSpace(source.Text) == "" {
+		return fmt.Errorf("%w: subject and text are required", ErrInvalidTemplate)
+	}
+	if err := parseTemplate(source); err != nil {
+		return err
+	}
+
+	if err := writeTemplateFile(source.Name, textExt, source.Text); err != nil {
+		return err
+	}
+	if strings.TrimSpace(source.HTML) != "" {
+		if err := writeTemplateFile(source.Name, htmlExt, source.HTML); err != nil {
+			return err
+		}
+	} else if err := os.Remove(filepath.Join(templatesDir, source.Name+htmlExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// the subject file marks the template as existing, so it is written last
+	return writeTemplateFile(source.Name, subjectExt, source.Subject)
+}
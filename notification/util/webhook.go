@@ -0,0 +1,90 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Helper function to check that a setting is an absolute http(s) URL
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: invalid %s %q", ErrConfig, name, value)
+	}
+	return nil
+}
+
+// Helper function to POST a JSON payload and wrap the outcome in its error
+// category. Authentication failures are configuration errors, 400 and 422
+// mean the gateway refused the recipient, and 408, 429 and 5xx are worth
+// another attempt.
+func postJSON(endpoint string, header http.Header, payload any) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: error marshaling payload: %v", ErrPermanentRecipient, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTransient, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s returned status %d", ErrConfig, endpoint, resp.StatusCode)
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w: %s returned status %d", ErrPermanentRecipient, endpoint, resp.StatusCode)
+	default:
+		return fmt.Errorf("%w: %s returned status %d", ErrTransient, endpoint, resp.StatusCode)
+	}
+}
+
+// WebhookSender posts every message as JSON to a fixed URL, leaving the
+// delivery to whatever system listens there
+type WebhookSender struct {
+	url string
+}
+
+func NewWebhookSender(url string) (*WebhookSender, error) {
+	if err := validateURL("WEBHOOK_URL", url); err != nil {
+		return nil, err
+	}
+	return &WebhookSender{url: url}, nil
+}
+
+// Any recipient is accepted: its meaning is up to the receiving system
+func (s *WebhookSender) ValidateRecipient(recipient string) error {
+	return nil
+}
+
+// Post the message to the webhook
+func (s *WebhookSender) Send(m Message) error {
+	return postJSON(s.url, nil, map[string]any{
+		"id":        m.ID,
+		"recipient": m.Recipient,
+		"subject":   m.Subject,
+		"message":   m.Body,
+		"html":      m.HTMLBody,
+		"calendar":  m.Calendar,
+	})
+}
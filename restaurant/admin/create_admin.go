@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"progetto/restaurant/server/config"
 	"progetto/restaurant/server/database"
 	"strings"
 
@@ -12,7 +13,18 @@ import (
 )
 
 func main() {
-	database.InitDatabase("../server/restaurant.db")
+	// the tool runs from its own directory, next to the server one
+	defaults := config.Default()
+	defaults.Database.Path = "../server/restaurant.db"
+	cfg, printOnly, err := config.LoadForTool(defaults, os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if printOnly {
+		return
+	}
+
+	database.InitDatabase(cfg.Database.Path)
 	defer database.CloseDatabase()
 
 	reader := bufio.NewReader(os.Stdin)
@@ -28,7 +40,7 @@ func main() {
 	password, _ := reader.ReadString('\n')
 	password = strings.TrimSpace(password)
 
-	email := "crisbi.restaurant@gmail.com"
+	email := cfg.Restaurant.Email
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -48,5 +60,5 @@ func main() {
 	fmt.Printf("Email: %s\n", email)
 	fmt.Println("Role: admin")
 	fmt.Println()
-	fmt.Println("You can now login at http://localhost:8080")
+	fmt.Printf("You can now login at %s\n", cfg.Server.PublicURL)
 }
@@ -1,31 +1,136 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"progetto/logging"
+	"progetto/restaurant/server/config"
 	"progetto/restaurant/server/database"
+	"progetto/restaurant/server/handler"
 	"progetto/restaurant/server/router_mux"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
+	// load the configuration: defaults, then file, environment and flags
+	cfg, printOnly, err := config.Load(config.Default(), os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if printOnly {
+		return
+	}
+
+	// structured logs from here on
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		log.Fatalf("Error configuring logs: %v", err)
+	}
+
+	// configure session lifetimes
+	database.SetSessionLifetime(database.SessionLifetime{
+		Idle:               cfg.Sessions.Idle,
+		Absolute:           cfg.Sessions.Absolute,
+		RememberMeIdle:     cfg.Sessions.RememberMeIdle,
+		RememberMeAbsolute: cfg.Sessions.RememberMeAbsolute,
+	})
+
+	// configure how long before the meal guests can still change a reservation
+	handler.SetCancellationCutoff(cfg.Reservations.CancellationCutoff)
+
+	// address notified of the changes and location of the calendar events
+	handler.SetRestaurantEmail(cfg.Restaurant.Email)
+	handler.SetRestaurantAddress(cfg.Restaurant.Address)
+
+	// address of the site in the links sent to the guests
+	handler.SetPublicURL(cfg.Server.PublicURL)
+
+	// key signing the confirm and cancel links sent to the guests
+	handler.SetLinkSecret(cfg.Server.LinkSecret)
+
+	// whether the session cookie follows the X-Forwarded-Proto of a proxy
+	handler.SetTrustProxy(cfg.Server.TrustProxy)
+
+	// address of the notification service and key signing the requests to it
+	handler.SetNotificationURL(cfg.Notification.URL)
+	handler.SetNotificationSigningKey(cfg.Notification.KeyID, cfg.Notification.KeySecret)
+
+	// configure when guests are reminded of their reservations
+	handler.SetReminderLeadTimes(cfg.Reservations.ReminderLeadTimes)
+
 	// initialize database
-	database.InitDatabase("./server/restaurant.db")
-	log.Println("Database initialized")
+	database.InitDatabase(cfg.Database.Path)
+	slog.Info("Database initialized", "path", cfg.Database.Path)
+
+	// stop on SIGINT or SIGTERM: the background jobs stop at once, the
+	// requests in flight are drained
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
+	// purge expired sessions in the background
+	database.StartSessionJanitor(ctx, &background, 10*time.Minute)
 
-	defer database.CloseDatabase()
+	// deliver queued notifications in the background
+	handler.StartNotificationDispatcher(ctx, &background, cfg.Notification.DispatchInterval)
 
-	templates, err := template.ParseGlob("server/templates/*.html")
+	// remind guests of their upcoming reservations
+	handler.StartReminderScheduler(ctx, &background, cfg.Reservations.ReminderInterval)
+
+	templates, err := template.ParseGlob(cfg.Server.Templates)
 	if err != nil {
-		log.Fatalf("Error loading templates: %v", err)
+		logging.Fatal("Error loading templates", "error", err)
 	}
 
+	handler.SetTemplates(templates)
 	router_mux.SetTemplates(templates)
-	r := router_mux.InitRouter()
 
-	log.Println("Server in esecuzione su http://localhost:8080")
-	err = http.ListenAndServe(":8080", r)
-	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           router_mux.InitRouter(),
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server started", "addr", cfg.Server.Addr, "public_url", cfg.Server.PublicURL)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	failed := false
+	select {
+	case err := <-serverErr:
+		slog.Error("Server failed", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("Shutting down, draining requests in flight")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+	background.Wait()
+
+	database.CloseDatabase()
+	slog.Info("Server stopped")
+	if failed {
+		os.Exit(1)
 	}
 }
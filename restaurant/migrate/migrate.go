@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"progetto/restaurant/server/config"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+)
+
+func usage() {
+	fmt.Println("Usage: go run . <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  up          apply all pending migrations")
+	fmt.Println("  down [n]    roll back the last n migrations (default 1)")
+	fmt.Println("  status      show applied and pending migrations")
+	fmt.Println()
+	fmt.Println("Options are the ones of the server, e.g. -db or -config; -h lists them.")
+}
+
+func main() {
+	// the command and its argument come first, the configuration options after
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	steps := 1
+	if command == "down" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid number of steps: %s", args[0])
+		}
+		steps, args = n, args[1:]
+	}
+
+	// the tool runs from its own directory, next to the server one
+	defaults := config.Default()
+	defaults.Database.Path = "../server/restaurant.db"
+	cfg, printOnly, err := config.LoadForTool(defaults, args, os.Stdout)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if printOnly {
+		return
+	}
+
+	if command == "" {
+		usage()
+		os.Exit(1)
+	}
+
+	database.OpenDatabase(cfg.Database.Path)
+	defer database.CloseDatabase()
+
+	switch command {
+	case "up":
+		if err := database.MigrateUp(); err != nil {
+			log.Fatalf("Error applying migrations: %v", err)
+		}
+		fmt.Println("Database is up to date")
+
+	case "down":
+		if err := database.MigrateDown(steps); err != nil {
+			log.Fatalf("Error rolling back migrations: %v", err)
+		}
+
+	case "status":
+		statuses, err := database.GetMigrationStatus()
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+
+		fmt.Println("=== Migration Status ===")
+		fmt.Println()
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("  [x] %04d_%s (applied %s)\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("  [ ] %04d_%s (pending)\n", s.Version, s.Name)
+			}
+		}
+
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
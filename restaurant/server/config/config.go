@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"progetto/logging"
+	"strings"
+	"time"
+)
+
+// Settings of the restaurant service. Every setting has a default, can be set
+// in the YAML configuration file and overridden by its environment variable
+// and then by its command-line flag.
+type Config struct {
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Notification NotificationConfig `yaml:"notification"`
+	Restaurant   RestaurantConfig   `yaml:"restaurant"`
+	Sessions     SessionsConfig     `yaml:"sessions"`
+	Reservations ReservationsConfig `yaml:"reservations"`
+	Log          LogConfig          `yaml:"log"`
+}
+
+type ServerConfig struct {
+	// Address the HTTP server listens on, e.g. ":8080"
+	Addr string `yaml:"addr"`
+	// Address of the site as seen by the guests, used for the links in the
+	// notifications
+	PublicURL string `yaml:"public_url"`
+	// Glob of the HTML templates of the pages
+	Templates string `yaml:"templates"`
+	// Key signing the confirm and cancel links sent to the guests
+	LinkSecret string `yaml:"link_secret"`
+	// The server runs behind a reverse proxy terminating TLS, whose
+	// X-Forwarded-Proto header tells whether a request came over HTTPS
+	TrustProxy bool `yaml:"trust_proxy"`
+	// Longest time to read a request and to write its response
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// How long an idle keep-alive connection is kept open
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// How long the requests in flight are waited for at shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	Path string `yaml:"path"`
+}
+
+type NotificationConfig struct {
+	// Base address of the notification service
+	URL string `yaml:"url"`
+	// Key signing the requests to the notification service
+	KeyID     string `yaml:"key_id"`
+	KeySecret string `yaml:"key_secret"`
+	// How often the outbox is delivered
+	DispatchInterval time.Duration `yaml:"dispatch_interval"`
+}
+
+type RestaurantConfig struct {
+	// Address notified when guests change their reservations, also used for
+	// the admin account
+	Email string `yaml:"email"`
+	// Location of the calendar events sent to the guests
+	Address string `yaml:"address"`
+}
+
+type SessionsConfig struct {
+	Idle               time.Duration `yaml:"idle"`
+	Absolute           time.Duration `yaml:"absolute"`
+	RememberMeIdle     time.Duration `yaml:"remember_me_idle"`
+	RememberMeAbsolute time.Duration `yaml:"remember_me_absolute"`
+}
+
+type ReservationsConfig struct {
+	// Minimum notice required to cancel or modify a reservation
+	CancellationCutoff time.Duration `yaml:"cancellation_cutoff"`
+	// How long before a confirmed reservation the guest is reminded of it
+	ReminderLeadTimes []time.Duration `yaml:"reminder_lead_times"`
+	// How often the due reminders are looked for
+	ReminderInterval time.Duration `yaml:"reminder_interval"`
+}
+
+type LogConfig struct {
+	// Lowest level written: debug, info, warn or error
+	Level string `yaml:"level"`
+	// Output format: json or text
+	Format string `yaml:"format"`
+}
+
+// Settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:      ":8080",
+			PublicURL: "http://localhost:8080",
+			Templates: "server/templates/*.html",
+
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Path: "./server/restaurant.db",
+		},
+		Notification: NotificationConfig{
+			URL:              "http://localhost:8081",
+			DispatchInterval: 10 * time.Second,
+		},
+		Restaurant: RestaurantConfig{
+			Email:   "crisbi.restaurant@gmail.com",
+			Address: "Crisbi's",
+		},
+		Sessions: SessionsConfig{
+			Idle:               30 * time.Minute,
+			Absolute:           12 * time.Hour,
+			RememberMeIdle:     14 * 24 * time.Hour,
+			RememberMeAbsolute: 90 * 24 * time.Hour,
+		},
+		Reservations: ReservationsConfig{
+			CancellationCutoff: 2 * time.Hour,
+			ReminderLeadTimes:  []time.Duration{24 * time.Hour, 2 * time.Hour},
+			ReminderInterval:   time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+	}
+}
+
+// Helper function to check that a setting is an absolute http(s) URL
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL, got %q", name, value)
+	}
+	return nil
+}
+
+// Check the settings of the server, reporting every invalid one
+func (c *Config) Validate() error {
+	return errors.Join(c.validateSettings(), c.validateSecrets())
+}
+
+// Check the secrets the server cannot run without. The command-line tools
+// only open the database and skip them.
+func (c *Config) validateSecrets() error {
+	var errs []error
+
+	// the notification service refuses unsigned requests, so without a key
+	// no notification would ever be delivered
+	if c.Notification.KeyID == "" || len(c.Notification.KeySecret) < 16 {
+		errs = append(errs, errors.New("notification.key_id and a notification.key_secret of at least 16 characters are required: the notification service only accepts signed requests"))
+	}
+
+	// a key changing at every start would break the links already sent
+	if len(c.Server.LinkSecret) < 32 {
+		errs = append(errs, errors.New("server.link_secret of at least 32 characters is required: it signs the links in the emails"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Helper function to check every setting but the secrets
+func (c *Config) validateSettings() error {
+	var errs []error
+
+	if !strings.Contains(c.Server.Addr, ":") {
+		errs = append(errs, fmt.Errorf("server.addr must be host:port or :port, got %q", c.Server.Addr))
+	}
+	if err := validateURL("server.public_url", c.Server.PublicURL); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Server.Templates == "" {
+		errs = append(errs, errors.New("server.templates is required"))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path is required"))
+	}
+
+	if err := validateURL("notification.url", c.Notification.URL); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := mail.ParseAddress(c.Restaurant.Email); err != nil {
+		errs = append(errs, fmt.Errorf("restaurant.email is not a valid address: %q", c.Restaurant.Email))
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"notification.dispatch_interval", c.Notification.DispatchInterval},
+		{"sessions.idle", c.Sessions.Idle},
+		{"sessions.absolute", c.Sessions.Absolute},
+		{"sessions.remember_me_idle", c.Sessions.RememberMeIdle},
+		{"sessions.remember_me_absolute", c.Sessions.RememberMeAbsolute},
+		{"reservations.reminder_interval", c.Reservations.ReminderInterval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.name, d.value))
+		}
+	}
+	if c.Sessions.Idle > c.Sessions.Absolute || c.Sessions.RememberMeIdle > c.Sessions.RememberMeAbsolute {
+		errs = append(errs, errors.New("the idle lifetime of a session cannot exceed its absolute lifetime"))
+	}
+	if c.Reservations.CancellationCutoff < 0 {
+		errs = append(errs, fmt.Errorf("reservations.cancellation_cutoff cannot be negative, got %s", c.Reservations.CancellationCutoff))
+	}
+	for _, lead := range c.Reservations.ReminderLeadTimes {
+		if lead <= 0 {
+			errs = append(errs, fmt.Errorf("reservations.reminder_lead_times must be positive, got %s", lead))
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		errs = append(errs, fmt.Errorf("log.format must be json or text, got %q", c.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Copy of the settings with the secrets hidden, for printing
+func (c Config) Redacted() Config {
+	if c.Server.LinkSecret != "" {
+		c.Server.LinkSecret = redacted
+	}
+	if c.Notification.KeySecret != "" {
+		c.Notification.KeySecret = redacted
+	}
+	return c
+}
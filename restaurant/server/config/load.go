@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Shown instead of the secrets by --print-config
+const redacted = "<redacted>"
+
+// Environment variable naming the configuration file, when --config is not
+// given
+const configFileEnv = "RESTAURANT_CONFIG"
+
+// A setting that can be overridden by an environment variable and by a flag.
+// Either name can be empty: secrets have no flag, so they never show up in
+// the process list.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(string) error
+}
+
+// Helper function to build the setting of a string
+func stringSetting(env, flagName, usage string, p *string) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		*p = value
+		return nil
+	}}
+}
+
+// Helper function to build the setting of a boolean, e.g. "true"
+func boolSetting(env, flagName, usage string, p *bool) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
+	}}
+}
+
+// Helper function to build the setting of a duration, e.g. "90m"
+func durationSetting(env, flagName, usage string, p *time.Duration) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}}
+}
+
+// Helper function to build the setting of a comma-separated list of
+// durations; "none" is an empty list
+func durationsSetting(env, flagName, usage string, p *[]time.Duration) setting {
+	return setting{env, flagName, usage, func(value string) error {
+		durations := []time.Duration{}
+		if value != "none" {
+			for _, part := range strings.Split(value, ",") {
+				d, err := time.ParseDuration(strings.TrimSpace(part))
+				if err != nil {
+					return err
+				}
+				durations = append(durations, d)
+			}
+		}
+		*p = durations
+		return nil
+	}}
+}
+
+// Helper function to list the settings of c
+func settings(c *Config) []setting {
+	return []setting{
+		stringSetting("HTTP_ADDR", "addr", "address the HTTP server listens on", &c.Server.Addr),
+		stringSetting("PUBLIC_URL", "public-url", "address of the site in the links sent to the guests", &c.Server.PublicURL),
+		stringSetting("TEMPLATES_GLOB", "templates", "glob of the HTML templates", &c.Server.Templates),
+		stringSetting("LINK_SECRET", "", "", &c.Server.LinkSecret),
+		boolSetting("TRUST_PROXY", "trust-proxy", "trust the X-Forwarded-Proto header of a reverse proxy", &c.Server.TrustProxy),
+		durationSetting("HTTP_READ_TIMEOUT", "", "", &c.Server.ReadTimeout),
+		durationSetting("HTTP_WRITE_TIMEOUT", "", "", &c.Server.WriteTimeout),
+		durationSetting("HTTP_IDLE_TIMEOUT", "", "", &c.Server.IdleTimeout),
+		durationSetting("HTTP_SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long the requests in flight are waited for at shutdown", &c.Server.ShutdownTimeout),
+		stringSetting("DATABASE_PATH", "db", "path of the SQLite database", &c.Database.Path),
+		stringSetting("NOTIFICATION_URL", "notification-url", "base address of the notification service", &c.Notification.URL),
+		stringSetting("NOTIFICATION_KEY_ID", "notification-key-id", "ID of the key signing the requests to the notification service", &c.Notification.KeyID),
+		stringSetting("NOTIFICATION_KEY_SECRET", "", "", &c.Notification.KeySecret),
+		durationSetting("NOTIFICATION_DISPATCH_INTERVAL", "dispatch-interval", "how often the outbox is delivered", &c.Notification.DispatchInterval),
+		stringSetting("RESTAURANT_EMAIL", "restaurant-email", "address notified of the changes made by the guests", &c.Restaurant.Email),
+		stringSetting("RESTAURANT_ADDRESS", "restaurant-address", "location of the calendar events", &c.Restaurant.Address),
+		durationSetting("SESSION_IDLE_TIMEOUT", "", "", &c.Sessions.Idle),
+		durationSetting("SESSION_ABSOLUTE_TIMEOUT", "", "", &c.Sessions.Absolute),
+		durationSetting("SESSION_REMEMBER_ME_IDLE_TIMEOUT", "", "", &c.Sessions.RememberMeIdle),
+		durationSetting("SESSION_REMEMBER_ME_ABSOLUTE_TIMEOUT", "", "", &c.Sessions.RememberMeAbsolute),
+		durationSetting("CANCELLATION_CUTOFF", "cancellation-cutoff", "minimum notice to cancel or modify a reservation", &c.Reservations.CancellationCutoff),
+		durationsSetting("REMINDER_LEAD_TIMES", "reminder-lead-times", `reminders before a reservation, e.g. "24h,2h", or "none"`, &c.Reservations.ReminderLeadTimes),
+		stringSetting("LOG_LEVEL", "log-level", "lowest level logged: debug, info, warn or error", &c.Log.Level),
+		stringSetting("LOG_FORMAT", "log-format", "format of the logs: json or text", &c.Log.Format),
+		durationSetting("REMINDER_INTERVAL", "reminder-interval", "how often the due reminders are looked for", &c.Reservations.ReminderInterval),
+	}
+}
+
+// Flag value keeping the text given on the command line, applied after the
+// file and the environment
+type flagValue struct {
+	value string
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// Load the settings, starting from defaults and applying in order the
+// configuration file, the environment and the command-line flags in args.
+// The file is given with --config or RESTAURANT_CONFIG. With --print-config
+// the settings are printed to out and printOnly is true.
+func Load(defaults Config, args []string, out io.Writer) (cfg Config, printOnly bool, err error) {
+	return load(defaults, args, out, (*Config).Validate)
+}
+
+// Load the settings like Load, for the command-line tools: the secrets of
+// the server are not required
+func LoadForTool(defaults Config, args []string, out io.Writer) (cfg Config, printOnly bool, err error) {
+	return load(defaults, args, out, (*Config).validateSettings)
+}
+
+func load(defaults Config, args []string, out io.Writer, validate func(*Config) error) (cfg Config, printOnly bool, err error) {
+	cfg = defaults
+	list := settings(&cfg)
+
+	fs := flag.NewFlagSet("restaurant", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(configFileEnv), "path of the YAML configuration file")
+	printConfig := fs.Bool("print-config", false, "print the configuration and exit")
+	flags := map[string]*flagValue{}
+	for _, s := range list {
+		if s.flag == "" {
+			continue
+		}
+		flags[s.flag] = &flagValue{}
+		fs.Var(flags[s.flag], s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *configFile != "" {
+		file, err := os.Open(*configFile)
+		if err != nil {
+			return cfg, false, fmt.Errorf("error reading configuration file: %v", err)
+		}
+		defer file.Close()
+
+		// unknown keys are errors, so a typo does not silently keep a default
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, false, fmt.Errorf("error parsing %s: %v", *configFile, err)
+		}
+	}
+
+	for _, s := range list {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(value); err != nil {
+				return cfg, false, fmt.Errorf("invalid value for %s: %v", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range list {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(flags[s.flag].value); err != nil {
+					flagErr = fmt.Errorf("invalid value for --%s: %v", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, false, flagErr
+	}
+
+	if err := validate(&cfg); err != nil {
+		return cfg, false, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	if *printConfig {
+		return cfg, true, Print(cfg, out)
+	}
+	return cfg, false, nil
+}
+
+// Print the settings as YAML, with the secrets hidden
+func Print(cfg Config, out io.Writer) error {
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -1,6 +1,9 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -31,7 +34,9 @@ func GetUserCredentials(username string) (string, string, error) {
 // Get user's reservations
 func GetUserReservations(email string) ([]Reservation, error) {
 	rows, err := db.Query(`
-		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email
+		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email, duration_minutes,
+			attendance_confirmed_at IS NOT NULL,
+			(SELECT GROUP_CONCAT(table_id) FROM reservation_tables WHERE reservation_id = reservations.id)
 		FROM reservations
 		WHERE email = ?
 		ORDER BY reservation_date DESC, reservation_time DESC
@@ -44,12 +49,46 @@ func GetUserReservations(email string) ([]Reservation, error) {
 	var reservations []Reservation
 	for rows.Next() {
 		var r Reservation
-		err := rows.Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email)
+		var tables sql.NullString
+		err := rows.Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email, &r.DurationMinutes, &r.AttendanceConfirmed, &tables)
 		if err != nil {
 			return nil, err
 		}
+		r.Tables = parseTableList(tables.String, r.TableNumber)
 		reservations = append(reservations, r)
 	}
 
 	return reservations, nil
 }
+
+// Get how the user wants to be notified: the channel and the phone number
+// used for SMS
+func GetNotificationPreferences(username string) (string, string, error) {
+	var channel, phone string
+	err := db.QueryRow("SELECT notification_channel, phone FROM accounts WHERE username = ?", username).Scan(&channel, &phone)
+	return channel, phone, err
+}
+
+// Update how the user wants to be notified
+func UpdateNotificationPreferences(username, channel, phone string) error {
+	_, err := db.Exec("UPDATE accounts SET notification_channel = ?, phone = ? WHERE username = ?",
+		channel, phone, username)
+	return err
+}
+
+// Get the channel and recipient to notify the owner of an email address. The
+// email itself is used when nobody with that address asked for SMS.
+func GetNotificationContact(email string) (string, string, error) {
+	var channel, phone string
+	err := db.QueryRow("SELECT notification_channel, phone FROM accounts WHERE email = ?", email).Scan(&channel, &phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChannelEmail, email, nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if channel == ChannelSMS && phone != "" {
+		return ChannelSMS, phone, nil
+	}
+	return ChannelEmail, email, nil
+}
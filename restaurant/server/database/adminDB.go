@@ -1,23 +1,121 @@
 package database
 
 import (
+	"errors"
+	"progetto/restaurant/server/metrics"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// Confirm a reservation
-func ConfirmReservation(reservationID int) error {
-	_, err := db.Exec("UPDATE reservations SET status = 'confirmed' WHERE id = ?", reservationID)
-	return err
+// Where a change to a reservation comes from, recorded with the change
+const (
+	SourceAdmin     = "admin"
+	SourceGuest     = "guest"
+	SourceAPI       = "api"
+	SourceEmailLink = "email_link"
+)
+
+// Returned when a reservation is no longer in a status the change applies
+// to, e.g. it was canceled while an admin was confirming it
+var ErrReservationStatusChanged = errors.New("reservation status changed")
+
+// Confirm a pending reservation, queuing the notifications in the same
+// transaction
+func ConfirmReservation(reservationID int, source string, notifications ...OutboxMessage) error {
+	return setReservationStatus(reservationID, "confirmed", []string{"pending"}, source, notifications)
 }
 
-// Reject a reservation
-func RejectReservation(reservationID int) error {
-	_, err := db.Exec("UPDATE reservations SET status = 'rejected' WHERE id = ?", reservationID)
+// Reject a pending reservation, queuing the notifications in the same
+// transaction
+func RejectReservation(reservationID int, source string, notifications ...OutboxMessage) error {
+	return setReservationStatus(reservationID, "rejected", []string{"pending"}, source, notifications)
+}
+
+// Record who changed a reservation and how
+func recordReservationEvent(q queryer, reservationID int, action, source string) error {
+	_, err := q.Exec("INSERT INTO reservation_events (reservation_id, action, source, created_at) VALUES (?, ?, ?, ?)",
+		reservationID, action, source, time.Now().UTC())
 	return err
 }
 
+// Change the status of a reservation and queue the notifications announcing
+// it, so that either both happen or neither does. The change only applies to
+// a reservation still in one of the from statuses, otherwise
+// ErrReservationStatusChanged is returned and nothing is queued: of two
+// concurrent changes only the first one takes effect.
+func setReservationStatus(reservationID int, status string, from []string, source string, notifications []OutboxMessage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	if err := tx.QueryRow("SELECT status FROM reservations WHERE id = ?", reservationID).Scan(&previous); err != nil {
+		return err
+	}
+	args := []any{status, reservationID}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := tx.Exec("UPDATE reservations SET status = ? WHERE id = ? AND status IN (?"+strings.Repeat(", ?", len(from)-1)+")", args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrReservationStatusChanged
+	}
+	if err := recordReservationEvent(tx, reservationID, status, source); err != nil {
+		return err
+	}
+	for _, n := range notifications {
+		if err := enqueueNotification(tx, n); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	metrics.ReservationTransition(previous, status)
+	return nil
+}
+
+// Record that the guest confirmed they are coming to a confirmed
+// reservation. Returns false when the attendance was already confirmed.
+func ConfirmAttendance(reservationID int, source string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE reservations SET attendance_confirmed_at = ?
+		WHERE id = ? AND status = 'confirmed' AND attendance_confirmed_at IS NULL`,
+		time.Now().UTC(), reservationID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	if err := recordReservationEvent(tx, reservationID, "attendance_confirmed", source); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
 // Get count of today's reservations
 func GetTodayReservationsCount() (int, error) {
 	today := time.Now().Format("2006-01-02")
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// API key of a user. Only a hash of the key is stored, the key itself is
+// shown once when it is created.
+type APIKey struct {
+	ID         int
+	Username   string
+	Name       string
+	Prefix     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// Hash an API key for storage and lookup
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Save a new API key for a user
+func SaveAPIKey(username, name, key string) (int64, error) {
+	prefix := key
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO api_keys (username, name, key_prefix, key_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		username, name, prefix, hashAPIKey(key), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Validate an API key and get the account it belongs to
+func ValidateAPIKey(key string) (*SessionUser, error) {
+	var id int
+	var user SessionUser
+	err := db.QueryRow(`
+		SELECT k.id, a.username, a.role, a.email
+		FROM api_keys k
+		JOIN accounts a ON a.username = k.username
+		WHERE k.key_hash = ?`, hashAPIKey(key)).Scan(&id, &user.Username, &user.Role, &user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().UTC(), id); err != nil {
+		slog.Error("Error updating API key usage", "error", err)
+	}
+	return &user, nil
+}
+
+// Get the API keys of a user
+func GetUserAPIKeys(username string) ([]APIKey, error) {
+	rows, err := db.Query(`
+		SELECT id, username, name, key_prefix, created_at, last_used_at
+		FROM api_keys
+		WHERE username = ?
+		ORDER BY created_at DESC
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var k APIKey
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Username, &k.Name, &k.Prefix, &k.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke an API key of a user. Returns sql.ErrNoRows when the user has no
+// such key.
+func RevokeAPIKey(username string, keyID int) error {
+	result, err := db.Exec("DELETE FROM api_keys WHERE id = ? AND username = ?", keyID, username)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,26 +1,39 @@
 package database
 
 import (
-	"database/sql"
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// Returned when the username or the email already belongs to an account
+var ErrAccountExists = errors.New("username or email already exists")
+
 // Register a new user with role
 func RegisterUser(username, hashedPassword, email, role string) error {
 	_, err := db.Exec("INSERT INTO accounts (username, password, email, role) VALUES (?, ?, ?, ?)",
 		username, hashedPassword, email, role)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrAccountExists
+	}
 	return err
 }
 
 // Remove a user
 func DeleteUser(username string) error {
+	if _, err := db.Exec("DELETE FROM api_keys WHERE username = ?", username); err != nil {
+		slog.Error("Error deleting API keys of user", "error", err)
+		return err
+	}
+
 	_, err := db.Exec("DELETE FROM accounts WHERE username = ?", username)
 	if err != nil {
-		log.Printf("Error deleting user from database: %v", err)
+		slog.Error("Error deleting user from database", "error", err)
 		return err
 	}
 	return nil
@@ -40,31 +53,81 @@ func GetUserRole(username string) (string, error) {
 	return role, err
 }
 
-// Save session token
-func SaveSessionToken(username, token string) error {
-	expiresAt := time.Now().Add(sessionTimeout)
-	_, err := db.Exec("INSERT INTO session_tokens (token, username, created_at, expires_at) VALUES (?, ?, ?, ?)",
-		token, username, time.Now(), expiresAt)
-	return err
+// Minimum interval between two refreshes of the same session
+const sessionRefreshInterval = time.Minute
+
+// Get the idle and absolute lifetime for a session
+func sessionWindows(persistent bool) (time.Duration, time.Duration) {
+	if persistent {
+		return sessionLifetime.RememberMeIdle, sessionLifetime.RememberMeAbsolute
+	}
+	return sessionLifetime.Idle, sessionLifetime.Absolute
+}
+
+// Compute the sliding expiry, never exceeding the absolute one
+func slidingExpiry(now, absoluteExpiresAt time.Time, idle time.Duration) time.Time {
+	expiresAt := now.Add(idle)
+	if expiresAt.After(absoluteExpiresAt) {
+		return absoluteExpiresAt
+	}
+	return expiresAt
 }
 
-// Validate session token
-func ValidateSessionToken(token string) (string, error) {
-	var username string
-	var expiresAt time.Time
-	err := db.QueryRow("SELECT username, expires_at FROM session_tokens WHERE token = ?", token).Scan(&username, &expiresAt)
+// Save session token and return its absolute expiry
+func SaveSessionToken(username, token string, persistent bool) (time.Time, error) {
+	now := time.Now().UTC()
+	idle, absolute := sessionWindows(persistent)
+	absoluteExpiresAt := now.Add(absolute)
+	expiresAt := slidingExpiry(now, absoluteExpiresAt, idle)
+
+	_, err := db.Exec(`
+		INSERT INTO session_tokens (token, username, created_at, last_seen_at, expires_at, absolute_expires_at, persistent)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token, username, now, now, expiresAt, absoluteExpiresAt, persistent)
+	return absoluteExpiresAt, err
+}
+
+// Returned when the session exists but has been idle for too long
+var ErrSessionExpired = errors.New("session expired")
+
+// Account owning a session
+type SessionUser struct {
+	Username string
+	Role     string
+	Email    string
+}
+
+// Validate session token, slide its expiry forward and get the account owning
+// it. Sessions left by a deleted account are not valid.
+func GetSessionUser(token string) (*SessionUser, error) {
+	var user SessionUser
+	var lastSeenAt, expiresAt, absoluteExpiresAt time.Time
+	var persistent bool
+	err := db.QueryRow(`
+		SELECT s.username, a.role, a.email, s.last_seen_at, s.expires_at, s.absolute_expires_at, s.persistent
+		FROM session_tokens s
+		JOIN accounts a ON a.username = s.username
+		WHERE s.token = ?`, token).Scan(&user.Username, &user.Role, &user.Email, &lastSeenAt, &expiresAt, &absoluteExpiresAt, &persistent)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", err
-		}
-		return "", err
+		return nil, err
 	}
 
-	if time.Now().After(expiresAt) {
-		return "", fmt.Errorf("session expired")
+	now := time.Now().UTC()
+	if now.After(expiresAt) {
+		return nil, ErrSessionExpired
 	}
 
-	return username, nil
+	// Refresh at most once per interval to avoid a write on every request
+	if now.Sub(lastSeenAt) >= sessionRefreshInterval {
+		idle, _ := sessionWindows(persistent)
+		_, err = db.Exec("UPDATE session_tokens SET last_seen_at = ?, expires_at = ? WHERE token = ?",
+			now, slidingExpiry(now, absoluteExpiresAt, idle), token)
+		if err != nil {
+			slog.Error("Error refreshing session", "error", err)
+		}
+	}
+
+	return &user, nil
 }
 
 // Delete session token
@@ -72,3 +135,86 @@ func DeleteSessionToken(token string) error {
 	_, err := db.Exec("DELETE FROM session_tokens WHERE token = ?", token)
 	return err
 }
+
+// Active session of a user
+type Session struct {
+	ID         int
+	Username   string
+	Role       string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Persistent bool
+}
+
+// Get all sessions that have not expired yet
+func GetActiveSessions() ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.username, COALESCE(a.role, ''), s.created_at, s.last_seen_at, s.expires_at, s.persistent
+		FROM session_tokens s
+		LEFT JOIN accounts a ON a.username = s.username
+		WHERE s.expires_at > ?
+		ORDER BY s.username ASC, s.created_at DESC
+	`, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.Username, &s.Role, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.Persistent); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke a single session by ID
+func RevokeSession(sessionID int) error {
+	_, err := db.Exec("DELETE FROM session_tokens WHERE id = ?", sessionID)
+	return err
+}
+
+// Revoke every session of a user
+func RevokeUserSessions(username string) error {
+	_, err := db.Exec("DELETE FROM session_tokens WHERE username = ?", username)
+	return err
+}
+
+// Delete all expired sessions
+func DeleteExpiredSessions() (int64, error) {
+	result, err := db.Exec("DELETE FROM session_tokens WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Periodically purge expired sessions until the context is canceled.
+// wg is done when the last run has finished.
+func StartSessionJanitor(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := DeleteExpiredSessions()
+			if err != nil {
+				slog.ErrorContext(ctx, "Error purging expired sessions", "error", err)
+			} else if purged > 0 {
+				slog.InfoContext(ctx, "Expired sessions purged", "count", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// Only a username or email already in use is reported as ErrAccountExists
+func TestRegisterUserExists(t *testing.T) {
+	openTestDatabase(t)
+
+	if err := RegisterUser("mario", "hash", "mario@example.com", "client"); err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if err := RegisterUser("mario", "hash", "other@example.com", "client"); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("same username: RegisterUser returned %v, want ErrAccountExists", err)
+	}
+	if err := RegisterUser("luigi", "hash", "mario@example.com", "client"); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("same email: RegisterUser returned %v, want ErrAccountExists", err)
+	}
+	// an invalid role violates a CHECK constraint, not a UNIQUE one
+	if err := RegisterUser("luigi", "hash", "luigi@example.com", "chef"); err == nil || errors.Is(err, ErrAccountExists) {
+		t.Errorf("invalid role: RegisterUser returned %v, want another error", err)
+	}
+}
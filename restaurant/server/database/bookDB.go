@@ -2,36 +2,164 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"progetto/restaurant/server/metrics"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// Create a new reservation
-func CreateReservation(name, email string, tableNumber int, date, time string, guests int) (int64, error) {
-	result, err := db.Exec(`
-		INSERT INTO reservations (name, email, table_number, reservation_date, reservation_time, guests, status)
-		VALUES (?, ?, ?, ?, ?, ?, 'pending')`,
-		name, email, tableNumber, date, time, guests)
+// Returned when no table can host the party in the requested slot
+var ErrNoAvailableTable = errors.New("no available table found")
+
+// Common interface of *sql.DB and *sql.Tx used by the booking queries
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Insert the reservation and link it to all of its tables.
+// table_number keeps the first table for display and backward compatibility.
+// The duration is stored with the reservation so later rule changes do not
+// alter the overlap checks of existing bookings.
+func createReservation(q queryer, name, email string, tables []int, date, time string, guests, duration int) (int64, error) {
+	result, err := q.Exec(`
+		INSERT INTO reservations (name, email, table_number, reservation_date, reservation_time, guests, status, duration_minutes)
+		VALUES (?, ?, ?, ?, ?, ?, 'pending', ?)`,
+		name, email, tables[0], date, time, guests, duration)
 
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	reservationID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tableID := range tables {
+		_, err := q.Exec("INSERT INTO reservation_tables (reservation_id, table_id) VALUES (?, ?)", reservationID, tableID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return reservationID, nil
+}
+
+// Cancel a pending or confirmed reservation, queuing the notifications in the
+// same transaction
+func CancelReservation(reservationID int, source string, notifications ...OutboxMessage) error {
+	return setReservationStatus(reservationID, "canceled", []string{"pending", "confirmed"}, source, notifications)
 }
 
-// Cancel a reservation
-func CancelReservation(reservationID int) error {
-	_, err := db.Exec("UPDATE reservations SET status = 'canceled' WHERE id = ?", reservationID)
-	return err
+// Get a reservation by ID
+func GetReservation(reservationID int) (*Reservation, error) {
+	var r Reservation
+	var tables sql.NullString
+	err := db.QueryRow(`
+		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email, duration_minutes,
+			attendance_confirmed_at IS NOT NULL,
+			(SELECT GROUP_CONCAT(table_id) FROM reservation_tables WHERE reservation_id = reservations.id)
+		FROM reservations
+		WHERE id = ?
+	`, reservationID).Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email, &r.DurationMinutes, &r.AttendanceConfirmed, &tables)
+	if err != nil {
+		return nil, err
+	}
+	r.Tables = parseTableList(tables.String, r.TableNumber)
+	return &r, nil
+}
+
+// Move a reservation to a new date, time and party size. Availability is
+// checked again, ignoring the reservation itself, and the tables are
+// reassigned in the same immediate transaction used by BookTable. The
+// reservation goes back to pending until the restaurant confirms it again,
+// and the guest has to confirm their attendance again. notify, if not nil,
+// builds the notifications of the change from the new tables; they are
+// queued in the same transaction. A reservation that is no longer pending or
+// confirmed is left untouched and ErrReservationStatusChanged is returned.
+func ModifyReservation(reservationID int, date, time string, guests int, source string, notify func(tables []int) []OutboxMessage) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	duration, err := getDiningDurationForSlot(tx, date, time, guests)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous string
+	if err := tx.QueryRow("SELECT status FROM reservations WHERE id = ?", reservationID).Scan(&previous); err != nil {
+		return nil, err
+	}
+	// the reservation may have been canceled or rejected since the caller
+	// checked it: a canceled reservation must not take tables again
+	if previous != "pending" && previous != "confirmed" {
+		return nil, ErrReservationStatusChanged
+	}
+
+	tables, err := findAvailableTables(tx, date, time, guests, duration, reservationID)
+	countTableSearch("modify", err)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE reservations
+		SET table_number = ?, reservation_date = ?, reservation_time = ?, guests = ?, duration_minutes = ?, status = 'pending',
+			attendance_confirmed_at = NULL
+		WHERE id = ?`,
+		tables[0], date, time, guests, duration, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM reservation_tables WHERE reservation_id = ?", reservationID); err != nil {
+		return nil, err
+	}
+	// the reminders sent so far were about the old date and time
+	if _, err := tx.Exec("DELETE FROM reservation_reminders WHERE reservation_id = ?", reservationID); err != nil {
+		return nil, err
+	}
+	for _, tableID := range tables {
+		_, err := tx.Exec("INSERT INTO reservation_tables (reservation_id, table_id) VALUES (?, ?)", reservationID, tableID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := recordReservationEvent(tx, reservationID, "modified", source); err != nil {
+		return nil, err
+	}
+
+	if notify != nil {
+		for _, n := range notify(tables) {
+			if err := enqueueNotification(tx, n); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	metrics.ReservationTransition(previous, "pending")
+	return tables, nil
 }
 
 // Get all reservations (admin function)
 func GetAllReservations() ([]Reservation, error) {
 	rows, err := db.Query(`
-		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email
+		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email, duration_minutes,
+			attendance_confirmed_at IS NOT NULL,
+			(SELECT GROUP_CONCAT(table_id) FROM reservation_tables WHERE reservation_id = reservations.id)
 		FROM reservations
 		ORDER BY reservation_date DESC, reservation_time DESC
 	`)
@@ -43,10 +171,12 @@ func GetAllReservations() ([]Reservation, error) {
 	var reservations []Reservation
 	for rows.Next() {
 		var r Reservation
-		err := rows.Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email)
+		var tables sql.NullString
+		err := rows.Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email, &r.DurationMinutes, &r.AttendanceConfirmed, &tables)
 		if err != nil {
 			return nil, err
 		}
+		r.Tables = parseTableList(tables.String, r.TableNumber)
 		reservations = append(reservations, r)
 	}
 
@@ -75,69 +205,200 @@ func GetAvailableTables() ([]map[string]interface{}, error) {
 	return tables, nil
 }
 
-// Find available tables for a specific date and time
-func FindAvailableTables(reservationDate, reservationTime string, guests int) (int, error) {
-	startTime, err := time.Parse("15:04", reservationTime)
+// Atomically find free tables and reserve them. The check and the insert run in
+// the same immediate transaction, so concurrent bookings for the same slot are
+// serialized by SQLite and can never be assigned the same table.
+func BookTable(name, email, date, time string, guests int) (int64, []int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	duration, err := getDiningDurationForSlot(tx, date, time, guests)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tables, err := findAvailableTables(tx, date, time, guests, duration, 0)
+	countTableSearch("book", err)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reservationID, err := createReservation(tx, name, email, tables, date, time, guests, duration)
 	if err != nil {
-		return 0, fmt.Errorf("invalid time format: %v", err)
+		return 0, nil, err
 	}
 
-	// Calculate end time (2 hours later)
-	endTime := startTime.Add(2 * time.Hour)
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	metrics.ReservationTransition(metrics.StatusNew, "pending")
+	return reservationID, tables, nil
+}
+
+// Helper function to count the outcome of a search for free tables. The
+// slot lists are not counted: they search every slot of the day and would
+// drown the searches of actual bookings.
+func countTableSearch(operation string, err error) {
+	switch {
+	case err == nil:
+		metrics.TableSearch(operation, metrics.TablesFound)
+	case errors.Is(err, ErrNoAvailableTable):
+		metrics.TableSearch(operation, metrics.TablesNoTable)
+	default:
+		metrics.TableSearch(operation, metrics.TablesError)
+	}
+}
+
+// Find available tables for a specific date and time.
+// A single table is preferred; large parties get a combinable table group.
+// excludeID skips a reservation in the overlap check, so that an existing
+// booking can be moved without conflicting with itself (0 excludes nothing).
+func findAvailableTables(q queryer, reservationDate, reservationTime string, guests, duration, excludeID int) ([]int, error) {
+	startTime, err := time.Parse("15:04", reservationTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time format: %v", err)
+	}
 
+	// Interval occupied by the new reservation, in minutes from midnight
 	newStartMinutes := startTime.Hour()*60 + startTime.Minute()
-	newEndMinutes := endTime.Hour()*60 + endTime.Minute()
-
-	if newEndMinutes == 0 {
-		newEndMinutes = 1440
-	}
-
-	query := `
-		SELECT id, seats FROM tables
-		WHERE seats >= ?
-		AND status = 'available'
-		AND id NOT IN (
-			SELECT table_number FROM reservations
-			WHERE reservation_date = ?
-			AND status NOT IN ('canceled', 'rejected')
-			AND (
-				(CAST(substr(reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(reservation_time, 4, 2) AS INTEGER)) < ?
-				AND
-				? < (CAST(substr(reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(reservation_time, 4, 2) AS INTEGER) + 120)
-			)
-		)
-		ORDER BY seats ASC
-		LIMIT 1;
-	`
+	newEndMinutes := newStartMinutes + duration
 
-	var tableID, seats int
-	err = db.QueryRow(query, guests, reservationDate, newEndMinutes, newStartMinutes).Scan(&tableID, &seats)
+	occupied, err := occupiedTables(q, reservationDate, newStartMinutes, newEndMinutes, excludeID)
+	if err != nil {
+		return nil, err
+	}
 
+	seats, err := availableTableSeats(q)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("no available table found")
+		return nil, err
+	}
+
+	// Smallest single table that fits the party
+	bestTable, bestSeats := 0, 0
+	for tableID, tableSeats := range seats {
+		if occupied[tableID] || tableSeats < guests {
+			continue
 		}
-		return 0, err
+		if bestTable == 0 || tableSeats < bestSeats || (tableSeats == bestSeats && tableID < bestTable) {
+			bestTable, bestSeats = tableID, tableSeats
+		}
+	}
+	if bestTable != 0 {
+		return []int{bestTable}, nil
+	}
+
+	// Smallest free group that fits the party, preferring fewer tables
+	groups, err := getTableGroups(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var bestGroup *TableGroup
+	bestSeats = 0
+	for i, group := range groups {
+		groupSeats, free := 0, true
+		for _, tableID := range group.Tables {
+			tableSeats, ok := seats[tableID]
+			if !ok || occupied[tableID] {
+				free = false
+				break
+			}
+			groupSeats += tableSeats
+		}
+		if !free || groupSeats < guests {
+			continue
+		}
+		if bestGroup == nil || groupSeats < bestSeats ||
+			(groupSeats == bestSeats && len(group.Tables) < len(bestGroup.Tables)) {
+			bestGroup, bestSeats = &groups[i], groupSeats
+		}
+	}
+	if bestGroup != nil {
+		return bestGroup.Tables, nil
+	}
+
+	return nil, ErrNoAvailableTable
+}
+
+// Get the tables already taken by active reservations overlapping the interval
+func occupiedTables(q queryer, reservationDate string, startMinutes, endMinutes, excludeID int) (map[int]bool, error) {
+	rows, err := q.Query(`
+		SELECT rt.table_id FROM reservation_tables rt
+		JOIN reservations r ON r.id = rt.reservation_id
+		WHERE r.reservation_date = ?
+		AND r.id != ?
+		AND r.status NOT IN ('canceled', 'rejected')
+		AND (
+			(CAST(substr(r.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(r.reservation_time, 4, 2) AS INTEGER)) < ?
+			AND
+			? < (CAST(substr(r.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(r.reservation_time, 4, 2) AS INTEGER) + r.duration_minutes)
+		)
+	`, reservationDate, excludeID, endMinutes, startMinutes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupied := map[int]bool{}
+	for rows.Next() {
+		var tableID int
+		if err := rows.Scan(&tableID); err != nil {
+			return nil, err
+		}
+		occupied[tableID] = true
 	}
-	return tableID, nil
+	return occupied, rows.Err()
 }
 
-// Get available time slots for a specific date and number of guests
-func GetAvailableTimeSlots(date string, guests int) ([]string, error) {
-	lunchSlots := []string{"12:00", "12:30", "13:00", "13:30", "14:00", "14:30"}
-	dinnerSlots := []string{"19:00", "19:30", "20:00", "20:30", "21:00", "21:30", "22:00"}
+// Get available time slots for a specific date and number of guests,
+// grouped by the service periods configured for that weekday.
+// Slots covered by a closure are never offered.
+func GetAvailableSlotsByPeriod(date string, guests int) ([]PeriodSlots, error) {
+	return getAvailableSlotsByPeriod(date, guests, 0)
+}
+
+// Get the slots an existing reservation could be moved to
+func GetAvailableSlotsForChange(reservationID int, date string, guests int) ([]PeriodSlots, error) {
+	return getAvailableSlotsByPeriod(date, guests, reservationID)
+}
 
-	allSlots := append(lunchSlots, dinnerSlots...)
-	availableSlots := []string{}
+func getAvailableSlotsByPeriod(date string, guests, excludeID int) ([]PeriodSlots, error) {
+	periods, err := GetServicePeriodsForDate(date)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, timeSlot := range allSlots {
-		tableID, err := FindAvailableTables(date, timeSlot, guests)
-		if err == nil && tableID > 0 {
-			availableSlots = append(availableSlots, timeSlot)
+	closures, err := GetClosuresForDate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []PeriodSlots
+	for _, period := range periods {
+		duration, err := GetDiningDuration(period, guests)
+		if err != nil {
+			return nil, err
+		}
+
+		available := PeriodSlots{Name: period.Name}
+		for _, timeSlot := range period.Slots() {
+			if _, closed := FindClosure(closures, timeSlot, duration); closed {
+				continue
+			}
+			tables, err := findAvailableTables(db, date, timeSlot, guests, duration, excludeID)
+			if err == nil && len(tables) > 0 {
+				available.Times = append(available.Times, timeSlot)
+			}
+		}
+		if len(available.Times) > 0 {
+			result = append(result, available)
 		}
 	}
 
-	return availableSlots, nil
+	return result, nil
 }
 
 // Reservation struct
@@ -145,9 +406,41 @@ type Reservation struct {
 	ID              int
 	Name            string
 	TableNumber     int
+	Tables          []int
 	ReservationDate string
 	ReservationTime string
 	Guests          int
 	Status          string
 	Email           string
+	DurationMinutes int
+	// The guest confirmed they are coming
+	AttendanceConfirmed bool
+}
+
+// Human readable list of the reserved tables, e.g. "5 + 6"
+func (r Reservation) TableLabel() string {
+	if len(r.Tables) == 0 {
+		return strconv.Itoa(r.TableNumber)
+	}
+	labels := make([]string, len(r.Tables))
+	for i, tableID := range r.Tables {
+		labels[i] = strconv.Itoa(tableID)
+	}
+	return strings.Join(labels, " + ")
+}
+
+// Parse a GROUP_CONCAT list of table IDs, falling back to the primary table
+func parseTableList(list string, fallback int) []int {
+	var tables []int
+	for _, part := range strings.Split(list, ",") {
+		tableID, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil {
+			tables = append(tables, tableID)
+		}
+	}
+	if len(tables) == 0 {
+		return []int{fallback}
+	}
+	sort.Ints(tables)
+	return tables
 }
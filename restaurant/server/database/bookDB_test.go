@@ -0,0 +1,168 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Open a migrated database in a temporary directory, closed with the test
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	InitDatabase(filepath.Join(t.TempDir(), "restaurant.db"))
+	t.Cleanup(CloseDatabase)
+}
+
+// Count tables holding two active reservations that overlap in time
+func countDoubleBookings(t *testing.T) int {
+	t.Helper()
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(DISTINCT ta.table_id)
+		FROM reservation_tables ta
+		JOIN reservation_tables tb ON ta.table_id = tb.table_id AND ta.reservation_id < tb.reservation_id
+		JOIN reservations a ON a.id = ta.reservation_id
+		JOIN reservations b ON b.id = tb.reservation_id
+		WHERE a.reservation_date = b.reservation_date
+		AND a.status NOT IN ('canceled', 'rejected')
+		AND b.status NOT IN ('canceled', 'rejected')
+		AND (CAST(substr(a.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(a.reservation_time, 4, 2) AS INTEGER))
+			< (CAST(substr(b.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(b.reservation_time, 4, 2) AS INTEGER) + b.duration_minutes)
+		AND (CAST(substr(b.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(b.reservation_time, 4, 2) AS INTEGER))
+			< (CAST(substr(a.reservation_time, 1, 2) AS INTEGER) * 60 + CAST(substr(a.reservation_time, 4, 2) AS INTEGER) + a.duration_minutes)
+	`).Scan(&count)
+	if err != nil {
+		t.Fatalf("counting double bookings: %v", err)
+	}
+	return count
+}
+
+// Fire many simultaneous bookings at the same slot and check that no table
+// ends up assigned to two overlapping reservations
+func TestBookTableConcurrent(t *testing.T) {
+	const bookings, guests, slot = 100, 2, "20:00"
+
+	openTestDatabase(t)
+
+	// Same composition as the seed script
+	capacity := 0
+	for _, tableType := range []struct{ seats, count int }{{2, 4}, {4, 4}, {6, 1}} {
+		for range tableType.count {
+			if _, err := db.Exec("INSERT INTO tables (seats) VALUES (?)", tableType.seats); err != nil {
+				t.Fatalf("inserting table: %v", err)
+			}
+			if tableType.seats >= guests {
+				capacity++
+			}
+		}
+	}
+
+	date := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		booked   int
+		failures []error
+		start    = make(chan struct{})
+	)
+	for i := range bookings {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			_, _, err := BookTable(fmt.Sprintf("Guest %d", i), fmt.Sprintf("guest%d@example.com", i), date, slot, guests)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				booked++
+			case !errors.Is(err, ErrNoAvailableTable):
+				failures = append(failures, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		t.Fatalf("%d bookings failed unexpectedly, first: %v", len(failures), failures[0])
+	}
+	if want := min(capacity, bookings); booked != want {
+		t.Fatalf("booked %d reservations, want %d", booked, want)
+	}
+	if n := countDoubleBookings(t); n > 0 {
+		t.Fatalf("%d tables are double-booked", n)
+	}
+}
+
+// A reservation can be canceled once: a second cancellation, e.g. a second
+// click on the link in the email, changes nothing and queues nothing
+func TestCancelReservationOnce(t *testing.T) {
+	openTestDatabase(t)
+	if _, err := db.Exec("INSERT INTO tables (seats) VALUES (2)"); err != nil {
+		t.Fatalf("inserting table: %v", err)
+	}
+
+	date := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	reservationID, _, err := BookTable("Guest", "guest@example.com", date, "20:00", 2)
+	if err != nil {
+		t.Fatalf("booking: %v", err)
+	}
+
+	notice := OutboxMessage{ReservationID: int(reservationID), Recipient: "guest@example.com", Subject: "Annullata", Body: "Annullata"}
+	if err := CancelReservation(int(reservationID), SourceGuest, notice); err != nil {
+		t.Fatalf("first cancellation: %v", err)
+	}
+	if err := CancelReservation(int(reservationID), SourceEmailLink, notice); !errors.Is(err, ErrReservationStatusChanged) {
+		t.Fatalf("second cancellation returned %v, want ErrReservationStatusChanged", err)
+	}
+	if err := ConfirmReservation(int(reservationID), SourceAdmin, notice); !errors.Is(err, ErrReservationStatusChanged) {
+		t.Fatalf("confirming a canceled reservation returned %v, want ErrReservationStatusChanged", err)
+	}
+
+	var queued int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE reservation_id = ?", reservationID).Scan(&queued); err != nil {
+		t.Fatalf("counting notifications: %v", err)
+	}
+	if queued != 1 {
+		t.Fatalf("%d notifications queued, want 1", queued)
+	}
+}
+
+// An edit cannot bring back a reservation canceled after the guest opened the
+// edit page: the reservation stays canceled at its old time
+func TestModifyCanceledReservation(t *testing.T) {
+	openTestDatabase(t)
+	if _, err := db.Exec("INSERT INTO tables (seats) VALUES (2)"); err != nil {
+		t.Fatalf("inserting table: %v", err)
+	}
+
+	date := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	reservationID, _, err := BookTable("Guest", "guest@example.com", date, "20:00", 2)
+	if err != nil {
+		t.Fatalf("booking: %v", err)
+	}
+	notice := OutboxMessage{ReservationID: int(reservationID), Recipient: "guest@example.com", Subject: "Annullata", Body: "Annullata"}
+	if err := CancelReservation(int(reservationID), SourceAdmin, notice); err != nil {
+		t.Fatalf("cancellation: %v", err)
+	}
+
+	_, err = ModifyReservation(int(reservationID), date, "21:00", 2, SourceGuest, nil)
+	if !errors.Is(err, ErrReservationStatusChanged) {
+		t.Fatalf("modifying a canceled reservation returned %v, want ErrReservationStatusChanged", err)
+	}
+
+	reservation, err := GetReservation(int(reservationID))
+	if err != nil {
+		t.Fatalf("GetReservation: %v", err)
+	}
+	if reservation.Status != "canceled" || reservation.ReservationTime != "20:00" {
+		t.Fatalf("reservation is %s at %s, want canceled at 20:00", reservation.Status, reservation.ReservationTime)
+	}
+}
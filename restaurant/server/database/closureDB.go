@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	ClosureOneOff    = "closure"
+	ClosureWeekly    = "weekly"
+	ClosureException = "exception"
+)
+
+// Closure of the restaurant. StartTime and EndTime are empty for full-day
+// closures; Date is used by one-off closures and exceptions, Weekday by
+// recurring weekly closures.
+type Closure struct {
+	ID        int
+	Kind      string
+	Date      string
+	Weekday   time.Weekday
+	StartTime string
+	EndTime   string
+	Reason    string
+}
+
+// Whether the closure lasts the whole day
+func (c Closure) FullDay() bool {
+	return c.StartTime == "" && c.EndTime == ""
+}
+
+// Helper function to convert a time of day (HH:MM) to minutes from midnight
+func clockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Whether a reservation starting at a slot (HH:MM) and lasting duration
+// minutes overlaps the closure, even if it starts before it
+func (c Closure) Covers(timeSlot string, duration int) bool {
+	if c.Kind == ClosureException {
+		return false
+	}
+	if c.FullDay() {
+		return true
+	}
+
+	start, err := clockMinutes(timeSlot)
+	if err != nil {
+		return false
+	}
+	closureStart, err := clockMinutes(c.StartTime)
+	if err != nil {
+		return false
+	}
+	closureEnd, err := clockMinutes(c.EndTime)
+	if err != nil {
+		return false
+	}
+	return start < closureEnd && start+duration > closureStart
+}
+
+// Italian name of the weekday of a weekly closure
+func (c Closure) WeekdayName() string {
+	return WeekdayName(c.Weekday)
+}
+
+// Check that the closure is well formed
+func (c Closure) Validate() error {
+	switch c.Kind {
+	case ClosureOneOff, ClosureException:
+		if _, err := time.Parse("2006-01-02", c.Date); err != nil {
+			return fmt.Errorf("invalid date: %s", c.Date)
+		}
+	case ClosureWeekly:
+		if c.Weekday < time.Sunday || c.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday: %d", c.Weekday)
+		}
+	default:
+		return fmt.Errorf("invalid closure kind: %s", c.Kind)
+	}
+
+	if c.FullDay() || c.Kind == ClosureException {
+		return nil
+	}
+	start, err := time.Parse("15:04", c.StartTime)
+	if err != nil {
+		return fmt.Errorf("invalid start time: %s", c.StartTime)
+	}
+	end, err := time.Parse("15:04", c.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid end time: %s", c.EndTime)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end time %s must be after start time %s", c.EndTime, c.StartTime)
+	}
+	return nil
+}
+
+// Convert an empty string to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func queryClosures(query string, args ...any) ([]Closure, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var closures []Closure
+	for rows.Next() {
+		var c Closure
+		var date, startTime, endTime sql.NullString
+		var weekday sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.Kind, &date, &weekday, &startTime, &endTime, &c.Reason); err != nil {
+			return nil, err
+		}
+		c.Date = date.String
+		c.Weekday = time.Weekday(weekday.Int64)
+		c.StartTime = startTime.String
+		c.EndTime = endTime.String
+		closures = append(closures, c)
+	}
+	return closures, rows.Err()
+}
+
+// Get all closures, recurring ones first, then by date
+func GetAllClosures() ([]Closure, error) {
+	return queryClosures(`
+		SELECT id, kind, closure_date, weekday, start_time, end_time, reason
+		FROM closures
+		ORDER BY kind = 'weekly' DESC, weekday ASC, closure_date ASC, start_time ASC
+	`)
+}
+
+// Get the closures in effect on a date (YYYY-MM-DD): the one-off closures of
+// that date plus the weekly ones, unless an exception reopens the day
+func GetClosuresForDate(date string) ([]Closure, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date format: %v", err)
+	}
+
+	candidates, err := queryClosures(`
+		SELECT id, kind, closure_date, weekday, start_time, end_time, reason
+		FROM closures
+		WHERE (kind IN ('closure', 'exception') AND closure_date = ?)
+		OR (kind = 'weekly' AND weekday = ?)
+		ORDER BY start_time ASC
+	`, date, int(day.Weekday()))
+	if err != nil {
+		return nil, err
+	}
+
+	hasException := false
+	for _, c := range candidates {
+		if c.Kind == ClosureException {
+			hasException = true
+		}
+	}
+
+	var closures []Closure
+	for _, c := range candidates {
+		if c.Kind == ClosureException || (c.Kind == ClosureWeekly && hasException) {
+			continue
+		}
+		closures = append(closures, c)
+	}
+	return closures, nil
+}
+
+// Find the closure overlapping a reservation of duration minutes starting at
+// a slot, if any
+func FindClosure(closures []Closure, timeSlot string, duration int) (Closure, bool) {
+	for _, c := range closures {
+		if c.Covers(timeSlot, duration) {
+			return c, true
+		}
+	}
+	return Closure{}, false
+}
+
+// Insert a closure
+func InsertClosure(c Closure) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	date, weekday, startTime, endTime := closureColumns(c)
+	_, err := db.Exec(`
+		INSERT INTO closures (kind, closure_date, weekday, start_time, end_time, reason)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		c.Kind, date, weekday, startTime, endTime, c.Reason)
+	return err
+}
+
+// Update a closure
+func UpdateClosure(c Closure) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	date, weekday, startTime, endTime := closureColumns(c)
+	_, err := db.Exec(`
+		UPDATE closures
+		SET kind = ?, closure_date = ?, weekday = ?, start_time = ?, end_time = ?, reason = ?
+		WHERE id = ?`,
+		c.Kind, date, weekday, startTime, endTime, c.Reason, c.ID)
+	return err
+}
+
+// Column values of a closure, with NULL for the fields its kind does not use
+func closureColumns(c Closure) (sql.NullString, sql.NullInt64, sql.NullString, sql.NullString) {
+	var date sql.NullString
+	var weekday sql.NullInt64
+	if c.Kind == ClosureWeekly {
+		weekday = sql.NullInt64{Int64: int64(c.Weekday), Valid: true}
+	} else {
+		date = nullString(c.Date)
+	}
+	if c.Kind == ClosureException {
+		return date, weekday, sql.NullString{}, sql.NullString{}
+	}
+	return date, weekday, nullString(c.StartTime), nullString(c.EndTime)
+}
+
+// Delete a closure
+func DeleteClosure(closureID int) error {
+	_, err := db.Exec("DELETE FROM closures WHERE id = ?", closureID)
+	return err
+}
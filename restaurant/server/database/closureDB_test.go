@@ -0,0 +1,32 @@
+package database
+
+import "testing"
+
+func TestClosureCovers(t *testing.T) {
+	event := Closure{Kind: ClosureOneOff, Date: "2026-12-20", StartTime: "20:00", EndTime: "23:00", Reason: "evento privato"}
+
+	tests := []struct {
+		slot     string
+		duration int
+		want     bool
+	}{
+		{"17:00", 120, false}, // ends before the event
+		{"18:00", 120, false}, // ends as the event starts
+		{"19:00", 120, true},  // still at the table when the event starts
+		{"20:00", 90, true},
+		{"22:30", 90, true},
+		{"23:00", 90, false}, // starts as the event ends
+	}
+	for _, tt := range tests {
+		if got := event.Covers(tt.slot, tt.duration); got != tt.want {
+			t.Errorf("Covers(%s, %d) = %v, want %v", tt.slot, tt.duration, got, tt.want)
+		}
+	}
+
+	if !(Closure{Kind: ClosureWeekly}).Covers("12:00", 60) {
+		t.Error("a full-day closure must cover every slot")
+	}
+	if (Closure{Kind: ClosureException, Date: "2026-12-24"}).Covers("12:00", 60) {
+		t.Error("an exception must not cover any slot")
+	}
+}
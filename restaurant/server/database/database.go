@@ -1,8 +1,9 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"progetto/logging"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -10,76 +11,66 @@ import (
 
 var db *sql.DB
 
-const sessionTimeout = 5 * time.Minute
+// Session lifetimes. Idle is the sliding window refreshed on every request,
+// Absolute caps the total duration of a session regardless of activity.
+// Remember-me sessions use their own pair of lifetimes.
+type SessionLifetime struct {
+	Idle               time.Duration
+	Absolute           time.Duration
+	RememberMeIdle     time.Duration
+	RememberMeAbsolute time.Duration
+}
 
-func InitDatabase(dbPath string) {
+var sessionLifetime = SessionLifetime{
+	Idle:               30 * time.Minute,
+	Absolute:           12 * time.Hour,
+	RememberMeIdle:     14 * 24 * time.Hour,
+	RememberMeAbsolute: 90 * 24 * time.Hour,
+}
 
+// Override the default session lifetimes
+func SetSessionLifetime(l SessionLifetime) {
+	sessionLifetime = l
+}
+
+// Open the database without touching the schema.
+// Transactions are started with BEGIN IMMEDIATE so that a read-then-write
+// sequence holds the write lock from the start, and concurrent writers wait
+// for the lock instead of failing with SQLITE_BUSY.
+func OpenDatabase(dbPath string) {
 	var err error
-	db, err = sql.Open("sqlite3", dbPath)
+	db, err = sql.Open("sqlite3", dbPath+"?_txlock=immediate&_busy_timeout=5000")
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		logging.Fatal("Error opening database", "error", err)
 	}
+}
 
-	_, err = db.Exec("DROP TABLE IF EXISTS session_tokens")
-	if err != nil {
-		log.Fatalf("Error dropping session_tokens table: %v", err)
-	}
+// Open the database and apply all pending schema migrations
+func InitDatabase(dbPath string) {
+	OpenDatabase(dbPath)
 
-	createTables := []string{
-		`CREATE TABLE IF NOT EXISTS accounts (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT NOT NULL UNIQUE,
-			password TEXT NOT NULL,
-			first_name TEXT NOT NULL DEFAULT 'Missing',
-			last_name TEXT NOT NULL DEFAULT 'Missing',
-			email TEXT NOT NULL UNIQUE,
-			role TEXT NOT NULL DEFAULT 'client' CHECK(role IN ('client', 'admin'))
-		)`,
-		`CREATE TABLE IF NOT EXISTS session_tokens (
-			token TEXT PRIMARY KEY,
-			username TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			expires_at TIMESTAMP NOT NULL,  
-			FOREIGN KEY(username) REFERENCES accounts(username)
-		)`,
-		`CREATE TABLE IF NOT EXISTS reservations (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			table_number INTEGER NOT NULL,
-			reservation_date TEXT NOT NULL,
-			reservation_time TEXT NOT NULL,
-			guests INTEGER NOT NULL,
-			status TEXT NOT NULL DEFAULT 'pending',
-			email TEXT
-		)`,
-		`CREATE TABLE IF NOT EXISTS tables (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			seats INTEGER NOT NULL,
-			status TEXT NOT NULL DEFAULT 'available'
-		)`,
+	if err := MigrateUp(); err != nil {
+		logging.Fatal("Error migrating database", "error", err)
 	}
+}
 
-	for _, query := range createTables {
-		_, err = db.Exec(query)
-		if err != nil {
-			log.Fatalf("Error creating table: %v", err)
-		}
-	}
+// Check that the database answers
+func PingDatabase(ctx context.Context) error {
+	return db.PingContext(ctx)
 }
 
 // Close Database
 func CloseDatabase() {
 	if err := db.Close(); err != nil {
-		log.Fatalf("Error closing database: %v", err)
+		logging.Fatal("Error closing database", "error", err)
 	}
 }
 
-// Insert table
-func InsertTable(seats int) error {
-
-	_, err := db.Exec("INSERT INTO tables (seats) VALUES (?)", seats)
+// Insert table, returning its ID
+func InsertTable(seats int) (int64, error) {
+	result, err := db.Exec("INSERT INTO tables (seats) VALUES (?)", seats)
 	if err != nil {
-		log.Print("errore")
+		return 0, err
 	}
-	return nil
+	return result.LastInsertId()
 }
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Used when no rule matches a party
+const DefaultDiningDuration = 120
+
+// How long a party of a given size occupies its tables. A rule applies to
+// one service period when ServicePeriodID is set, to every service period
+// named PeriodName otherwise, e.g. every "Cena", and to every service period
+// when both are empty.
+type DiningDuration struct {
+	ID              int
+	ServicePeriodID int
+	PeriodName      string
+	// Description of the periods the rule applies to, e.g. "Lunedì - Pranzo"
+	ServicePeriod   string
+	MinGuests       int
+	MaxGuests       int
+	DurationMinutes int
+}
+
+// Check that the rule is well formed
+func (d DiningDuration) Validate() error {
+	if d.ServicePeriodID != 0 && d.PeriodName != "" {
+		return fmt.Errorf("a rule applies either to a service period or to a name")
+	}
+	if d.MinGuests < 1 || d.MaxGuests < d.MinGuests {
+		return fmt.Errorf("invalid guests range: %d-%d", d.MinGuests, d.MaxGuests)
+	}
+	if d.DurationMinutes < 15 || d.DurationMinutes > 600 {
+		return fmt.Errorf("duration must be between 15 and 600 minutes")
+	}
+	return nil
+}
+
+// Get all dining duration rules: the generic ones first, then the rules for
+// a name and last the ones for a single service period
+func GetDiningDurations() ([]DiningDuration, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.service_period_id, d.service_period, p.weekday, p.name, d.min_guests, d.max_guests, d.duration_minutes
+		FROM dining_durations d
+		LEFT JOIN service_periods p ON p.id = d.service_period_id
+		ORDER BY d.service_period_id IS NOT NULL, d.service_period IS NOT NULL, d.service_period,
+			(p.weekday + 6) % 7, p.start_time, d.min_guests
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var durations []DiningDuration
+	for rows.Next() {
+		var d DiningDuration
+		var periodID, weekday sql.NullInt64
+		var periodName, name sql.NullString
+		if err := rows.Scan(&d.ID, &periodID, &periodName, &weekday, &name, &d.MinGuests, &d.MaxGuests, &d.DurationMinutes); err != nil {
+			return nil, err
+		}
+		switch {
+		case periodID.Valid:
+			d.ServicePeriodID = int(periodID.Int64)
+			d.ServicePeriod = WeekdayName(time.Weekday(weekday.Int64)) + " - " + name.String
+		case periodName.Valid:
+			d.PeriodName = periodName.String
+			d.ServicePeriod = "Ogni giorno - " + periodName.String
+		}
+		durations = append(durations, d)
+	}
+	return durations, rows.Err()
+}
+
+// Get the dining duration in minutes for a party in a service period. Rules
+// for the period itself win over rules for its name, which win over generic
+// ones; then the narrowest guests range wins.
+func GetDiningDuration(period ServicePeriod, guests int) (int, error) {
+	return getDiningDuration(db, period, guests)
+}
+
+func getDiningDuration(q queryer, period ServicePeriod, guests int) (int, error) {
+	var duration int
+	err := q.QueryRow(`
+		SELECT duration_minutes FROM dining_durations
+		WHERE ? BETWEEN min_guests AND max_guests
+		AND (service_period_id = ?
+			OR (service_period_id IS NULL AND (service_period IS NULL OR service_period = ?)))
+		ORDER BY service_period_id IS NULL, service_period IS NULL, max_guests - min_guests
+		LIMIT 1
+	`, guests, period.ID, period.Name).Scan(&duration)
+	if err == sql.ErrNoRows {
+		return DefaultDiningDuration, nil
+	}
+	return duration, err
+}
+
+// Get the dining duration of a party booking a slot on a date
+func GetDiningDurationForSlot(date, timeSlot string, guests int) (int, error) {
+	return getDiningDurationForSlot(db, date, timeSlot, guests)
+}
+
+func getDiningDurationForSlot(q queryer, date, timeSlot string, guests int) (int, error) {
+	period, _, err := findServicePeriod(q, date, timeSlot)
+	if err != nil {
+		return 0, err
+	}
+	return getDiningDuration(q, period, guests)
+}
+
+// Insert a dining duration rule
+func InsertDiningDuration(d DiningDuration) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	var periodID, periodName any
+	if d.ServicePeriodID != 0 {
+		periodID = d.ServicePeriodID
+	}
+	if d.PeriodName != "" {
+		periodName = d.PeriodName
+	}
+	_, err := db.Exec(`
+		INSERT INTO dining_durations (service_period_id, service_period, min_guests, max_guests, duration_minutes)
+		VALUES (?, ?, ?, ?, ?)`,
+		periodID, periodName, d.MinGuests, d.MaxGuests, d.DurationMinutes)
+	return err
+}
+
+// Delete a dining duration rule
+func DeleteDiningDuration(durationID int) error {
+	_, err := db.Exec("DELETE FROM dining_durations WHERE id = ?", durationID)
+	return err
+}
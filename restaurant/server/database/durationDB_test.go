@@ -0,0 +1,56 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// A rule for one service period wins over a rule for every period with its
+// name, which wins over the default
+func TestBookTableDurationOfServicePeriod(t *testing.T) {
+	openTestDatabase(t)
+
+	for range 4 {
+		if _, err := db.Exec("INSERT INTO tables (seats) VALUES (4)"); err != nil {
+			t.Fatalf("inserting table: %v", err)
+		}
+	}
+
+	monday := time.Now().AddDate(0, 0, 7+int(time.Monday-time.Now().Weekday())).Format("2006-01-02")
+	tuesday := time.Now().AddDate(0, 0, 8+int(time.Monday-time.Now().Weekday())).Format("2006-01-02")
+	mondayDinner, ok, err := FindServicePeriod(monday, "20:00")
+	if err != nil || !ok {
+		t.Fatalf("FindServicePeriod(%s, 20:00) = %v, %v", monday, ok, err)
+	}
+	rules := []DiningDuration{
+		{PeriodName: "Cena", MinGuests: 1, MaxGuests: 4, DurationMinutes: 100},
+		{ServicePeriodID: mondayDinner.ID, MinGuests: 1, MaxGuests: 4, DurationMinutes: 150},
+	}
+	for _, rule := range rules {
+		if err := InsertDiningDuration(rule); err != nil {
+			t.Fatalf("InsertDiningDuration: %v", err)
+		}
+	}
+
+	tests := []struct {
+		date, time string
+		want       int
+	}{
+		{monday, "20:00", 150},
+		{tuesday, "20:00", 100},
+		{tuesday, "12:30", DefaultDiningDuration},
+	}
+	for _, tt := range tests {
+		id, _, err := BookTable("Mario Rossi", "mario@example.com", tt.date, tt.time, 2)
+		if err != nil {
+			t.Fatalf("BookTable(%s %s): %v", tt.date, tt.time, err)
+		}
+		reservation, err := GetReservation(int(id))
+		if err != nil {
+			t.Fatalf("GetReservation: %v", err)
+		}
+		if reservation.DurationMinutes != tt.want {
+			t.Errorf("%s %s: duration = %d, want %d", tt.date, tt.time, reservation.DurationMinutes, tt.want)
+		}
+	}
+}
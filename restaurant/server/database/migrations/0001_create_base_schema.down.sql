@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tables;
+DROP TABLE IF EXISTS reservations;
+DROP TABLE IF EXISTS session_tokens;
+DROP TABLE IF EXISTS accounts;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	first_name TEXT NOT NULL DEFAULT 'Missing',
+	last_name TEXT NOT NULL DEFAULT 'Missing',
+	email TEXT NOT NULL UNIQUE,
+	role TEXT NOT NULL DEFAULT 'client' CHECK(role IN ('client', 'admin'))
+);
+
+CREATE TABLE IF NOT EXISTS session_tokens (
+	token TEXT PRIMARY KEY,
+	username TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(username) REFERENCES accounts(username)
+);
+
+CREATE TABLE IF NOT EXISTS reservations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	table_number INTEGER NOT NULL,
+	reservation_date TEXT NOT NULL,
+	reservation_time TEXT NOT NULL,
+	guests INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	email TEXT
+);
+
+CREATE TABLE IF NOT EXISTS tables (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	seats INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'available'
+);
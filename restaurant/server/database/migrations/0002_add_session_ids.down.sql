@@ -0,0 +1,14 @@
+CREATE TABLE session_tokens_old (
+	token TEXT PRIMARY KEY,
+	username TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(username) REFERENCES accounts(username)
+);
+
+INSERT INTO session_tokens_old (token, username, created_at, expires_at)
+SELECT token, username, created_at, expires_at FROM session_tokens;
+
+DROP TABLE session_tokens;
+
+ALTER TABLE session_tokens_old RENAME TO session_tokens;
@@ -0,0 +1,18 @@
+CREATE TABLE session_tokens_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token TEXT NOT NULL UNIQUE,
+	username TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(username) REFERENCES accounts(username)
+);
+
+INSERT INTO session_tokens_new (token, username, created_at, expires_at)
+SELECT token, username, created_at, expires_at FROM session_tokens;
+
+DROP TABLE session_tokens;
+
+ALTER TABLE session_tokens_new RENAME TO session_tokens;
+
+CREATE INDEX idx_session_tokens_username ON session_tokens(username);
+CREATE INDEX idx_session_tokens_expires_at ON session_tokens(expires_at);
@@ -0,0 +1,3 @@
+ALTER TABLE session_tokens DROP COLUMN persistent;
+ALTER TABLE session_tokens DROP COLUMN absolute_expires_at;
+ALTER TABLE session_tokens DROP COLUMN last_seen_at;
@@ -0,0 +1,5 @@
+ALTER TABLE session_tokens ADD COLUMN last_seen_at TIMESTAMP;
+ALTER TABLE session_tokens ADD COLUMN absolute_expires_at TIMESTAMP;
+ALTER TABLE session_tokens ADD COLUMN persistent INTEGER NOT NULL DEFAULT 0;
+
+UPDATE session_tokens SET last_seen_at = created_at, absolute_expires_at = expires_at;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reservation_tables;
+DROP TABLE IF EXISTS table_group_members;
+DROP TABLE IF EXISTS table_groups;
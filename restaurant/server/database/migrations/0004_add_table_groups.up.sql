@@ -0,0 +1,25 @@
+CREATE TABLE table_groups (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE table_group_members (
+	group_id INTEGER NOT NULL,
+	table_id INTEGER NOT NULL,
+	PRIMARY KEY (group_id, table_id),
+	FOREIGN KEY(group_id) REFERENCES table_groups(id) ON DELETE CASCADE,
+	FOREIGN KEY(table_id) REFERENCES tables(id) ON DELETE CASCADE
+);
+
+CREATE TABLE reservation_tables (
+	reservation_id INTEGER NOT NULL,
+	table_id INTEGER NOT NULL,
+	PRIMARY KEY (reservation_id, table_id),
+	FOREIGN KEY(reservation_id) REFERENCES reservations(id) ON DELETE CASCADE,
+	FOREIGN KEY(table_id) REFERENCES tables(id)
+);
+
+CREATE INDEX idx_reservation_tables_table_id ON reservation_tables(table_id);
+
+INSERT INTO reservation_tables (reservation_id, table_id)
+SELECT id, table_number FROM reservations;
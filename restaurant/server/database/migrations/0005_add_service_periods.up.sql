@@ -0,0 +1,21 @@
+CREATE TABLE service_periods (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	weekday INTEGER NOT NULL CHECK(weekday BETWEEN 0 AND 6),
+	name TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	last_seating TEXT NOT NULL,
+	slot_interval INTEGER NOT NULL DEFAULT 30 CHECK(slot_interval > 0)
+);
+
+CREATE INDEX idx_service_periods_weekday ON service_periods(weekday);
+
+-- Lunch 12:00-14:30 and dinner 19:00-22:00 every day, as previously hard-coded
+WITH RECURSIVE weekdays(day) AS (
+	SELECT 0
+	UNION ALL
+	SELECT day + 1 FROM weekdays WHERE day < 6
+)
+INSERT INTO service_periods (weekday, name, start_time, last_seating, slot_interval)
+SELECT day, 'Pranzo', '12:00', '14:30', 30 FROM weekdays
+UNION ALL
+SELECT day, 'Cena', '19:00', '22:00', 30 FROM weekdays;
@@ -0,0 +1,16 @@
+-- kind 'closure':   one-off closure on date
+-- kind 'weekly':    recurring closure every weekday
+-- kind 'exception': date on which weekly closures do not apply
+-- start_time/end_time are NULL for full-day closures
+CREATE TABLE closures (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL CHECK(kind IN ('closure', 'weekly', 'exception')),
+	closure_date TEXT,
+	weekday INTEGER CHECK(weekday BETWEEN 0 AND 6),
+	start_time TEXT,
+	end_time TEXT,
+	reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_closures_date ON closures(closure_date);
+CREATE INDEX idx_closures_weekday ON closures(weekday);
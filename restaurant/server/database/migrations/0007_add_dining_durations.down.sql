@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS dining_durations;
+ALTER TABLE reservations DROP COLUMN duration_minutes;
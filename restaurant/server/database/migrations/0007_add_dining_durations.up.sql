@@ -0,0 +1,14 @@
+-- Existing reservations keep the previous fixed duration of 120 minutes
+ALTER TABLE reservations ADD COLUMN duration_minutes INTEGER NOT NULL DEFAULT 120;
+
+-- service_period NULL means the rule applies to every service period
+CREATE TABLE dining_durations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	service_period TEXT,
+	min_guests INTEGER NOT NULL CHECK(min_guests >= 1),
+	max_guests INTEGER NOT NULL CHECK(max_guests >= min_guests),
+	duration_minutes INTEGER NOT NULL CHECK(duration_minutes > 0)
+);
+
+INSERT INTO dining_durations (service_period, min_guests, max_guests, duration_minutes)
+VALUES (NULL, 1, 99, 120);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL,
+	name TEXT NOT NULL,
+	key_prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	FOREIGN KEY(username) REFERENCES accounts(username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_username ON api_keys(username);
@@ -0,0 +1,17 @@
+-- Notifications are written here in the same transaction as the change they
+-- announce and delivered by a background dispatcher
+CREATE TABLE IF NOT EXISTS notification_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reservation_id INTEGER,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'sent', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(status, next_attempt_at);
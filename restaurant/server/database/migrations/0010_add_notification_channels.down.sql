@@ -0,0 +1,4 @@
+ALTER TABLE notification_outbox DROP COLUMN channel;
+
+ALTER TABLE accounts DROP COLUMN notification_channel;
+ALTER TABLE accounts DROP COLUMN phone;
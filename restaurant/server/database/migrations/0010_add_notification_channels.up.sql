@@ -0,0 +1,5 @@
+-- Guests can choose to be notified by SMS instead of email
+ALTER TABLE accounts ADD COLUMN phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN notification_channel TEXT NOT NULL DEFAULT 'email' CHECK(notification_channel IN ('email', 'sms'));
+
+ALTER TABLE notification_outbox ADD COLUMN channel TEXT NOT NULL DEFAULT 'email';
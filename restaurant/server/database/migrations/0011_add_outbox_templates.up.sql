@@ -0,0 +1,4 @@
+-- Messages can name a template of the notification service instead of
+-- carrying their own subject and body
+ALTER TABLE notification_outbox ADD COLUMN template TEXT NOT NULL DEFAULT '';
+ALTER TABLE notification_outbox ADD COLUMN template_data TEXT NOT NULL DEFAULT '';
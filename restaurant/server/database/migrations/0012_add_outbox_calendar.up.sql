@@ -0,0 +1,2 @@
+-- Calendar event attached to the message as an .ics file, as JSON
+ALTER TABLE notification_outbox ADD COLUMN calendar TEXT NOT NULL DEFAULT '';
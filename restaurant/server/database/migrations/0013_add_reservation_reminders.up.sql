@@ -0,0 +1,9 @@
+-- Reminders already queued, one row per reservation and lead time, so a
+-- restart never sends the same reminder twice
+CREATE TABLE reservation_reminders (
+	reservation_id INTEGER NOT NULL,
+	lead_minutes INTEGER NOT NULL,
+	sent_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (reservation_id, lead_minutes),
+	FOREIGN KEY(reservation_id) REFERENCES reservations(id)
+);
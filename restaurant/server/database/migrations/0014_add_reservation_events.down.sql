@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP COLUMN attendance_confirmed_at;
+
+DROP INDEX IF EXISTS idx_reservation_events_reservation;
+DROP TABLE IF EXISTS reservation_events;
@@ -0,0 +1,15 @@
+-- Status changes of the reservations and who made them, e.g. the restaurant
+-- from the dashboard or the guest from the link in an email
+CREATE TABLE reservation_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reservation_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	source TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(reservation_id) REFERENCES reservations(id)
+);
+
+CREATE INDEX idx_reservation_events_reservation ON reservation_events(reservation_id);
+
+-- Set when the guest confirms they are coming
+ALTER TABLE reservations ADD COLUMN attendance_confirmed_at TIMESTAMP;
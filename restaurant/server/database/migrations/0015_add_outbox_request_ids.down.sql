@@ -0,0 +1 @@
+ALTER TABLE notification_outbox DROP COLUMN request_id;
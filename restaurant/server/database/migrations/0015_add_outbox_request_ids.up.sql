@@ -0,0 +1,3 @@
+-- ID of the request that queued the message, passed on to the notification
+-- service so the delivery can be matched with the request in the logs
+ALTER TABLE notification_outbox ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_dining_durations_period;
+
+CREATE TABLE dining_durations_by_name (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	service_period TEXT,
+	min_guests INTEGER NOT NULL CHECK(min_guests >= 1),
+	max_guests INTEGER NOT NULL CHECK(max_guests >= min_guests),
+	duration_minutes INTEGER NOT NULL CHECK(duration_minutes > 0)
+);
+
+INSERT INTO dining_durations_by_name (service_period, min_guests, max_guests, duration_minutes)
+SELECT DISTINCT p.name, d.min_guests, d.max_guests, d.duration_minutes
+FROM dining_durations d
+LEFT JOIN service_periods p ON p.id = d.service_period_id;
+
+DROP TABLE dining_durations;
+ALTER TABLE dining_durations_by_name RENAME TO dining_durations;
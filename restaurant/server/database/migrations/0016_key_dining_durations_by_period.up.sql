@@ -0,0 +1,26 @@
+-- Rules refer to their service period by ID instead of by name, so renaming
+-- a period keeps its rules. A rule for a name becomes one rule for each
+-- period with that name; rules for names no period has anymore are dropped.
+-- service_period_id NULL means the rule applies to every service period.
+CREATE TABLE dining_durations_by_period (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	service_period_id INTEGER,
+	min_guests INTEGER NOT NULL CHECK(min_guests >= 1),
+	max_guests INTEGER NOT NULL CHECK(max_guests >= min_guests),
+	duration_minutes INTEGER NOT NULL CHECK(duration_minutes > 0),
+	FOREIGN KEY(service_period_id) REFERENCES service_periods(id) ON DELETE CASCADE
+);
+
+INSERT INTO dining_durations_by_period (service_period_id, min_guests, max_guests, duration_minutes)
+SELECT NULL, min_guests, max_guests, duration_minutes
+FROM dining_durations
+WHERE service_period IS NULL
+UNION ALL
+SELECT p.id, d.min_guests, d.max_guests, d.duration_minutes
+FROM dining_durations d
+JOIN service_periods p ON p.name = d.service_period;
+
+DROP TABLE dining_durations;
+ALTER TABLE dining_durations_by_period RENAME TO dining_durations;
+
+CREATE INDEX idx_dining_durations_period ON dining_durations(service_period_id);
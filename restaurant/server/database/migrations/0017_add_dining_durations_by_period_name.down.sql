@@ -0,0 +1,10 @@
+-- A rule for a name becomes one rule for each period with that name
+INSERT INTO dining_durations (service_period_id, min_guests, max_guests, duration_minutes)
+SELECT p.id, d.min_guests, d.max_guests, d.duration_minutes
+FROM dining_durations d
+JOIN service_periods p ON p.name = d.service_period
+WHERE d.service_period_id IS NULL;
+
+DELETE FROM dining_durations WHERE service_period IS NOT NULL;
+
+ALTER TABLE dining_durations DROP COLUMN service_period;
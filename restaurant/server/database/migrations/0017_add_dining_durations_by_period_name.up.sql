@@ -0,0 +1,4 @@
+-- A rule can also apply to every service period with a given name, e.g.
+-- every dinner, besides one period of one weekday or every period.
+-- service_period_id, when set, wins over service_period.
+ALTER TABLE dining_durations ADD COLUMN service_period TEXT;
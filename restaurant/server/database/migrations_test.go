@@ -0,0 +1,138 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// Helper function to read the schema of the database, without the
+// bookkeeping of the migrations
+func schema(t *testing.T) map[string]string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT IN ('schema_migrations', 'sqlite_sequence')`)
+	if err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+	defer rows.Close()
+
+	objects := map[string]string{}
+	for rows.Next() {
+		var name, sql string
+		if err := rows.Scan(&name, &sql); err != nil {
+			t.Fatalf("reading schema: %v", err)
+		}
+		objects[name] = sql
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+	return objects
+}
+
+// Helper function to check that every migration is applied, or none is
+func checkMigrationStatus(t *testing.T, applied bool) {
+	t.Helper()
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("no migrations found")
+	}
+	for i, s := range statuses {
+		if s.Version != i+1 {
+			t.Fatalf("migration %d has version %d, want %d", i, s.Version, i+1)
+		}
+		if s.Applied != applied {
+			t.Errorf("migration %d (%s): applied = %t, want %t", s.Version, s.Name, s.Applied, applied)
+		}
+	}
+}
+
+// Every migration can be rolled back and applied again, ending with the
+// same schema
+func TestMigrateRoundTrip(t *testing.T) {
+	OpenDatabase(filepath.Join(t.TempDir(), "restaurant.db"))
+	t.Cleanup(CloseDatabase)
+
+	if err := MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	checkMigrationStatus(t, true)
+	migrated := schema(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if err := MigrateDown(len(migrations)); err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	checkMigrationStatus(t, false)
+	if left := schema(t); len(left) > 0 {
+		t.Errorf("rolling back every migration left %v", left)
+	}
+
+	if err := MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp after MigrateDown: %v", err)
+	}
+	checkMigrationStatus(t, true)
+	remigrated := schema(t)
+	for name, sql := range migrated {
+		if remigrated[name] != sql {
+			t.Errorf("%s differs after the round trip:\n%s\nwant:\n%s", name, remigrated[name], sql)
+		}
+	}
+	for name := range remigrated {
+		if _, ok := migrated[name]; !ok {
+			t.Errorf("%s appeared after the round trip", name)
+		}
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"0010_add_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+		"0002_add_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"0002_add_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_add_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"0001_add_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"README.md":           {Data: []byte("ignored")},
+		"0010_add_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	migrations, err := readMigrations(files)
+	if err != nil {
+		t.Fatalf("readMigrations: %v", err)
+	}
+	var versions []int
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if len(versions) != 3 || versions[0] != 1 || versions[1] != 2 || versions[2] != 10 {
+		t.Fatalf("versions = %v, want [1 2 10]", versions)
+	}
+	if migrations[1].Name != "add_b" || migrations[1].Down != "DROP TABLE b;" {
+		t.Errorf("migration 2 = %+v", migrations[1])
+	}
+
+	invalid := []fstest.MapFS{
+		{ // two migrations with the same version
+			"0001_add_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+			"0001_add_b.up.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		},
+		{ // a down script without its up script
+			"0001_add_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		},
+		{ // no version
+			"add_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		},
+	}
+	for _, files := range invalid {
+		if _, err := readMigrations(files); err == nil {
+			t.Errorf("readMigrations(%v) returned no error", files)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Named service period of a weekday (e.g. lunch, dinner)
+type ServicePeriod struct {
+	ID           int
+	Weekday      time.Weekday
+	Name         string
+	StartTime    string
+	LastSeating  string
+	SlotInterval int
+}
+
+// Bookable time slots of a service period
+type PeriodSlots struct {
+	Name  string
+	Times []string
+}
+
+var weekdayNames = [...]string{"Domenica", "Lunedì", "Martedì", "Mercoledì", "Giovedì", "Venerdì", "Sabato"}
+
+// Italian name of a weekday
+func WeekdayName(day time.Weekday) string {
+	return weekdayNames[day]
+}
+
+// Italian name of the weekday of the period
+func (p ServicePeriod) WeekdayName() string {
+	return WeekdayName(p.Weekday)
+}
+
+// All slots from the start time to the last seating, one every interval
+func (p ServicePeriod) Slots() []string {
+	start, err := time.Parse("15:04", p.StartTime)
+	if err != nil {
+		return nil
+	}
+	last, err := time.Parse("15:04", p.LastSeating)
+	if err != nil || p.SlotInterval <= 0 {
+		return nil
+	}
+
+	var slots []string
+	for t := start; !t.After(last); t = t.Add(time.Duration(p.SlotInterval) * time.Minute) {
+		slots = append(slots, t.Format("15:04"))
+	}
+	return slots
+}
+
+// Check that the period is well formed
+func (p ServicePeriod) Validate() error {
+	if p.Weekday < time.Sunday || p.Weekday > time.Saturday {
+		return fmt.Errorf("invalid weekday: %d", p.Weekday)
+	}
+	if p.Name == "" {
+		return fmt.Errorf("missing service period name")
+	}
+	start, err := time.Parse("15:04", p.StartTime)
+	if err != nil {
+		return fmt.Errorf("invalid start time: %s", p.StartTime)
+	}
+	last, err := time.Parse("15:04", p.LastSeating)
+	if err != nil {
+		return fmt.Errorf("invalid last seating time: %s", p.LastSeating)
+	}
+	if last.Before(start) {
+		return fmt.Errorf("last seating %s is before start time %s", p.LastSeating, p.StartTime)
+	}
+	if p.SlotInterval < 5 || p.SlotInterval > 240 {
+		return fmt.Errorf("slot interval must be between 5 and 240 minutes")
+	}
+	return nil
+}
+
+// Get all service periods ordered by weekday and start time
+func GetAllServicePeriods() ([]ServicePeriod, error) {
+	return queryServicePeriods(db, `
+		SELECT id, weekday, name, start_time, last_seating, slot_interval
+		FROM service_periods
+		ORDER BY weekday ASC, start_time ASC
+	`)
+}
+
+// Get the service periods of a weekday ordered by start time
+func GetServicePeriods(weekday time.Weekday) ([]ServicePeriod, error) {
+	return getServicePeriods(db, weekday)
+}
+
+func getServicePeriods(q queryer, weekday time.Weekday) ([]ServicePeriod, error) {
+	return queryServicePeriods(q, `
+		SELECT id, weekday, name, start_time, last_seating, slot_interval
+		FROM service_periods
+		WHERE weekday = ?
+		ORDER BY start_time ASC
+	`, int(weekday))
+}
+
+func queryServicePeriods(q queryer, query string, args ...any) ([]ServicePeriod, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []ServicePeriod
+	for rows.Next() {
+		var p ServicePeriod
+		var weekday int
+		if err := rows.Scan(&p.ID, &weekday, &p.Name, &p.StartTime, &p.LastSeating, &p.SlotInterval); err != nil {
+			return nil, err
+		}
+		p.Weekday = time.Weekday(weekday)
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+// Get the service periods of the weekday of a date (YYYY-MM-DD)
+func GetServicePeriodsForDate(date string) ([]ServicePeriod, error) {
+	return getServicePeriodsForDate(db, date)
+}
+
+func getServicePeriodsForDate(q queryer, date string) ([]ServicePeriod, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date format: %v", err)
+	}
+	return getServicePeriods(q, day.Weekday())
+}
+
+// Find the service period offering a slot on a date
+func FindServicePeriod(date, timeSlot string) (ServicePeriod, bool, error) {
+	return findServicePeriod(db, date, timeSlot)
+}
+
+func findServicePeriod(q queryer, date, timeSlot string) (ServicePeriod, bool, error) {
+	periods, err := getServicePeriodsForDate(q, date)
+	if err != nil {
+		return ServicePeriod{}, false, err
+	}
+
+	for _, p := range periods {
+		for _, slot := range p.Slots() {
+			if slot == timeSlot {
+				return p, true, nil
+			}
+		}
+	}
+	return ServicePeriod{}, false, nil
+}
+
+// Insert a service period
+func InsertServicePeriod(p ServicePeriod) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO service_periods (weekday, name, start_time, last_seating, slot_interval)
+		VALUES (?, ?, ?, ?, ?)`,
+		int(p.Weekday), p.Name, p.StartTime, p.LastSeating, p.SlotInterval)
+	return err
+}
+
+// Update a service period
+func UpdateServicePeriod(p ServicePeriod) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		UPDATE service_periods
+		SET weekday = ?, name = ?, start_time = ?, last_seating = ?, slot_interval = ?
+		WHERE id = ?`,
+		int(p.Weekday), p.Name, p.StartTime, p.LastSeating, p.SlotInterval, p.ID)
+	return err
+}
+
+// Delete a service period together with its dining duration rules
+func DeleteServicePeriod(periodID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM dining_durations WHERE service_period_id = ?", periodID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM service_periods WHERE id = ?", periodID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// Channels the notification service delivers messages over
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Email waiting in the outbox. Failed messages gave up after the last
+// attempt and are only sent again when an admin resends them.
+type OutboxMessage struct {
+	ID            int
+	ReservationID int
+	// Delivery channel, email when empty
+	Channel   string
+	Recipient string
+	// Template of the notification service and its data; when empty the
+	// message is sent with Subject and Body as they are
+	Template      string
+	TemplateData  map[string]any
+	Calendar      *CalendarEvent
+	Subject       string
+	Body          string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+	// ID of the request that queued the message, empty when it was queued
+	// in the background
+	RequestID string
+}
+
+// Calendar event the notification service attaches to an email as an .ics
+// file. A cancellation must use the UID of the original event.
+type CalendarEvent struct {
+	UID             string    `json:"uid"`
+	Start           time.Time `json:"start"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Summary         string    `json:"summary"`
+	Description     string    `json:"description"`
+	Location        string    `json:"location"`
+	Cancelled       bool      `json:"cancelled"`
+}
+
+// Add a message to the outbox, ready to be sent
+func enqueueNotification(q queryer, m OutboxMessage) error {
+	now := time.Now().UTC()
+	if m.Channel == "" {
+		m.Channel = ChannelEmail
+	}
+	var reservationID sql.NullInt64
+	if m.ReservationID != 0 {
+		reservationID = sql.NullInt64{Int64: int64(m.ReservationID), Valid: true}
+	}
+
+	var templateData []byte
+	if m.Template != "" {
+		var err error
+		templateData, err = json.Marshal(m.TemplateData)
+		if err != nil {
+			return err
+		}
+	}
+
+	var calendar []byte
+	if m.Calendar != nil {
+		var err error
+		calendar, err = json.Marshal(m.Calendar)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := q.Exec(`
+		INSERT INTO notification_outbox (reservation_id, channel, recipient, template, template_data, calendar, subject, body, status, next_attempt_at, created_at, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?, ?)`,
+		reservationID, m.Channel, m.Recipient, m.Template, string(templateData), string(calendar), m.Subject, m.Body, now, now, m.RequestID)
+	return err
+}
+
+func queryOutbox(query string, args ...any) ([]OutboxMessage, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var reservationID sql.NullInt64
+		var templateData, calendar string
+		var sentAt sql.NullTime
+		err := rows.Scan(&m.ID, &reservationID, &m.Channel, &m.Recipient, &m.Template, &templateData, &calendar, &m.Subject, &m.Body, &m.Status,
+			&m.Attempts, &m.NextAttemptAt, &m.LastError, &m.CreatedAt, &sentAt, &m.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		m.ReservationID = int(reservationID.Int64)
+		if templateData != "" {
+			if err := json.Unmarshal([]byte(templateData), &m.TemplateData); err != nil {
+				return nil, err
+			}
+		}
+		if calendar != "" {
+			m.Calendar = &CalendarEvent{}
+			if err := json.Unmarshal([]byte(calendar), m.Calendar); err != nil {
+				return nil, err
+			}
+		}
+		if sentAt.Valid {
+			m.SentAt = &sentAt.Time
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// Get the pending messages whose next attempt is due, oldest first
+func GetDueNotifications(limit int) ([]OutboxMessage, error) {
+	return queryOutbox(`
+		SELECT id, reservation_id, channel, recipient, template, template_data, calendar, subject, body, status, attempts, next_attempt_at, last_error, created_at, sent_at, request_id
+		FROM notification_outbox
+		WHERE status = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC
+		LIMIT ?
+	`, time.Now().UTC(), limit)
+}
+
+// Get the messages with a given status, newest first
+func GetOutboxMessages(status string, limit int) ([]OutboxMessage, error) {
+	return queryOutbox(`
+		SELECT id, reservation_id, channel, recipient, template, template_data, calendar, subject, body, status, attempts, next_attempt_at, last_error, created_at, sent_at, request_id
+		FROM notification_outbox
+		WHERE status = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, status, limit)
+}
+
+// Count the messages of every status
+func GetOutboxCounts() (map[string]int, error) {
+	rows, err := db.Query("SELECT status, COUNT(*) FROM notification_outbox GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// Mark a message as delivered
+func MarkNotificationSent(messageID int) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		UPDATE notification_outbox
+		SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = ?
+		WHERE id = ?`, now, messageID)
+	return err
+}
+
+// Record a failed attempt. The message is retried at nextAttemptAt, or moved
+// to the failed ones when giveUp is true.
+func MarkNotificationAttemptFailed(messageID int, lastError string, nextAttemptAt time.Time, giveUp bool) error {
+	status := OutboxPending
+	if giveUp {
+		status = OutboxFailed
+	}
+	_, err := db.Exec(`
+		UPDATE notification_outbox
+		SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`, status, lastError, nextAttemptAt.UTC(), messageID)
+	return err
+}
+
+// Put a pending or failed message back in the queue for immediate delivery,
+// with a new budget of attempts. Returns sql.ErrNoRows when the message does
+// not exist or was already sent.
+func ResendNotification(messageID int) error {
+	result, err := db.Exec(`
+		UPDATE notification_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND status IN ('pending', 'failed')`, time.Now().UTC(), messageID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Get the confirmed reservations between two dates, included, soonest first
+func GetConfirmedReservationsBetween(fromDate, toDate string) ([]Reservation, error) {
+	rows, err := db.Query(`
+		SELECT id, name, table_number, reservation_date, reservation_time, guests, status, email, duration_minutes,
+			attendance_confirmed_at IS NOT NULL,
+			(SELECT GROUP_CONCAT(table_id) FROM reservation_tables WHERE reservation_id = reservations.id)
+		FROM reservations
+		WHERE status = 'confirmed' AND reservation_date BETWEEN ? AND ?
+		ORDER BY reservation_date ASC, reservation_time ASC
+	`, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	for rows.Next() {
+		var r Reservation
+		var tables sql.NullString
+		err := rows.Scan(&r.ID, &r.Name, &r.TableNumber, &r.ReservationDate, &r.ReservationTime, &r.Guests, &r.Status, &r.Email, &r.DurationMinutes, &r.AttendanceConfirmed, &tables)
+		if err != nil {
+			return nil, err
+		}
+		r.Tables = parseTableList(tables.String, r.TableNumber)
+		reservations = append(reservations, r)
+	}
+
+	return reservations, rows.Err()
+}
+
+// Check whether the reminder with the given lead time was already queued
+func ReminderSent(reservationID, leadMinutes int) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM reservation_reminders WHERE reservation_id = ? AND lead_minutes = ?",
+		reservationID, leadMinutes).Scan(&n)
+	return n > 0, err
+}
+
+// Record a reminder and queue its notification in the same transaction.
+// Returns false, queuing nothing, when the reminder was already recorded or
+// when the reservation is no longer confirmed for the date and time it was
+// read with, e.g. because it was canceled or moved in the meantime.
+func QueueReminder(reservation *Reservation, leadMinutes int, notification OutboxMessage) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO reservation_reminders (reservation_id, lead_minutes, sent_at)
+		SELECT ?, ?, ?
+		WHERE EXISTS (
+			SELECT 1 FROM reservations
+			WHERE id = ? AND status = 'confirmed' AND reservation_date = ? AND reservation_time = ?
+		)`, reservation.ID, leadMinutes, time.Now().UTC(),
+		reservation.ID, reservation.ReservationDate, reservation.ReservationTime)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	if err := enqueueNotification(tx, notification); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
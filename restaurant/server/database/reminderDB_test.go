@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// A reminder is queued only for a reservation still confirmed at the date and
+// time it was read with, and only once
+func TestQueueReminder(t *testing.T) {
+	openTestDatabase(t)
+	for range 3 {
+		if _, err := db.Exec("INSERT INTO tables (seats) VALUES (2)"); err != nil {
+			t.Fatalf("inserting table: %v", err)
+		}
+	}
+
+	date := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	book := func() *Reservation {
+		t.Helper()
+		id, _, err := BookTable("Guest", "guest@example.com", date, "20:00", 2)
+		if err != nil {
+			t.Fatalf("booking: %v", err)
+		}
+		if err := ConfirmReservation(int(id), SourceAdmin); err != nil {
+			t.Fatalf("confirming: %v", err)
+		}
+		reservation, err := GetReservation(int(id))
+		if err != nil {
+			t.Fatalf("GetReservation: %v", err)
+		}
+		return reservation
+	}
+	notice := func(r *Reservation) OutboxMessage {
+		return OutboxMessage{ReservationID: r.ID, Recipient: r.Email, Subject: "Promemoria", Body: "Ti aspettiamo"}
+	}
+
+	confirmed := book()
+	canceled := book()
+	if err := CancelReservation(canceled.ID, SourceGuest); err != nil {
+		t.Fatalf("canceling: %v", err)
+	}
+	moved := book()
+	if _, err := db.Exec("UPDATE reservations SET reservation_time = '21:00' WHERE id = ?", moved.ID); err != nil {
+		t.Fatalf("moving: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		reservation *Reservation
+		want        bool
+	}{
+		{"confirmed", confirmed, true},
+		{"already queued", confirmed, false},
+		{"canceled", canceled, false},
+		{"moved", moved, false},
+	}
+	for _, tt := range tests {
+		queued, err := QueueReminder(tt.reservation, 60, notice(tt.reservation))
+		if err != nil {
+			t.Fatalf("%s: QueueReminder: %v", tt.name, err)
+		}
+		if queued != tt.want {
+			t.Errorf("%s: QueueReminder = %t, want %t", tt.name, queued, tt.want)
+		}
+	}
+
+	var reminders int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE subject = 'Promemoria'").Scan(&reminders); err != nil {
+		t.Fatalf("counting reminders: %v", err)
+	}
+	if reminders != 1 {
+		t.Fatalf("%d reminders queued, want 1", reminders)
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Set of adjacent tables that can be joined for a larger party
+type TableGroup struct {
+	ID     int
+	Name   string
+	Tables []int
+}
+
+// Create a table group from the given tables
+func InsertTableGroup(name string, tables []int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO table_groups (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+
+	groupID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tableID := range tables {
+		_, err := tx.Exec("INSERT INTO table_group_members (group_id, table_id) VALUES (?, ?)", groupID, tableID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return groupID, tx.Commit()
+}
+
+// Get all table groups
+func GetTableGroups() ([]TableGroup, error) {
+	return getTableGroups(db)
+}
+
+func getTableGroups(q queryer) ([]TableGroup, error) {
+	rows, err := q.Query(`
+		SELECT g.id, g.name, m.table_id
+		FROM table_groups g
+		JOIN table_group_members m ON m.group_id = g.id
+		ORDER BY g.id, m.table_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []TableGroup
+	for rows.Next() {
+		var groupID, tableID int
+		var name string
+		if err := rows.Scan(&groupID, &name, &tableID); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].ID != groupID {
+			groups = append(groups, TableGroup{ID: groupID, Name: name})
+		}
+		last := &groups[len(groups)-1]
+		last.Tables = append(last.Tables, tableID)
+	}
+	return groups, rows.Err()
+}
+
+// Get the number of seats of every available table
+func availableTableSeats(q queryer) (map[int]int, error) {
+	rows, err := q.Query("SELECT id, seats FROM tables WHERE status = 'available'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seats := map[int]int{}
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		seats[id] = n
+	}
+	return seats, rows.Err()
+}
+
+// Get the largest party that a single table or a table group can host
+func GetMaxPartySize() (int, error) {
+	seats, err := availableTableSeats(db)
+	if err != nil {
+		return 0, err
+	}
+
+	groups, err := getTableGroups(db)
+	if err != nil {
+		return 0, err
+	}
+
+	maxSize := 0
+	for _, n := range seats {
+		maxSize = max(maxSize, n)
+	}
+	for _, group := range groups {
+		total, complete := 0, true
+		for _, tableID := range group.Tables {
+			n, ok := seats[tableID]
+			if !ok {
+				complete = false
+				break
+			}
+			total += n
+		}
+		if complete {
+			maxSize = max(maxSize, total)
+		}
+	}
+	return maxSize, nil
+}
@@ -1,20 +1,37 @@
 package handler
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"progetto/restaurant/server/database"
+	"regexp"
 )
 
+// Phone numbers in international format, e.g. +393331234567
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Helper function to check the notification preferences, returning the
+// message to show when they are not valid, or nil
+func validateNotificationPreferences(channel, phone string) *guestMessage {
+	if channel != database.ChannelEmail && channel != database.ChannelSMS {
+		return &guestMessage{"Canale di notifica non valido.", "Invalid notification channel."}
+	}
+	if phone != "" && !phonePattern.MatchString(phone) {
+		return &guestMessage{
+			"Numero di telefono non valido. Usa il formato internazionale, ad esempio +393331234567.",
+			"Invalid phone number. Use the international format, e.g. +393331234567.",
+		}
+	}
+	if channel == database.ChannelSMS && phone == "" {
+		return &guestMessage{"Inserisci un numero di telefono per ricevere le notifiche via SMS.", "A phone number is required for SMS notifications."}
+	}
+	return nil
+}
+
 func InformationHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
 	userInformation := Data{}
 
-	username, err := getUsernameFromSession(r)
-	if err != nil {
-		http.Error(w, "Error retrieving username from session", http.StatusInternalServerError)
-		return
-	}
+	username := getSessionUser(r).Username
 
 	// Manage the GET request
 	if r.Method == http.MethodGet {
@@ -36,10 +53,19 @@ func InformationHandler(w http.ResponseWriter, r *http.Request) {
 			lastName = ""
 		}
 
+		channel, phone, err := database.GetNotificationPreferences(username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting notification preferences", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
 		userInformation = Data{
-			FirstName: firstName,
-			LastName:  lastName,
-			Email:     email,
+			FirstName:           firstName,
+			LastName:            lastName,
+			Email:               email,
+			Phone:               phone,
+			NotificationChannel: channel,
 		}
 
 		err = templates.ExecuteTemplate(w, "account.html", userInformation)
@@ -61,11 +87,28 @@ func InformationHandler(w http.ResponseWriter, r *http.Request) {
 		userInformation.FirstName = r.FormValue("first_name")
 		userInformation.LastName = r.FormValue("last_name")
 		userInformation.Email = r.FormValue("email")
+		userInformation.Phone = r.FormValue("phone")
+		userInformation.NotificationChannel = r.FormValue("notification_channel")
+
+		if message := validateNotificationPreferences(userInformation.NotificationChannel, userInformation.Phone); message != nil {
+			userInformation.Error = message.Italian
+			if err := templates.ExecuteTemplate(w, "account.html", userInformation); err != nil {
+				http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			}
+			return
+		}
 
 		// Insert the informations
-		err = database.UpdateInformation(username, userInformation.FirstName, userInformation.LastName, userInformation.Email)
+		err := database.UpdateInformation(username, userInformation.FirstName, userInformation.LastName, userInformation.Email)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error inserting account", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = database.UpdateNotificationPreferences(username, userInformation.NotificationChannel, userInformation.Phone)
 		if err != nil {
-			log.Printf("Error inserting account: %v", err)
+			slog.ErrorContext(r.Context(), "Error updating notification preferences", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -74,17 +117,11 @@ func InformationHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	// Delete account
 	if r.Method == http.MethodPost {
-		log.Printf("metodo delete in corso")
+		slog.DebugContext(r.Context(), "Deleting account")
 
-		username, err := getUsernameFromSession(r)
-		if err != nil {
-			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
-			return
-		}
+		username := getSessionUser(r).Username
 
 		// Delete the user from the database
 		if err := database.DeleteUser(username); err != nil {
@@ -1,11 +1,12 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"progetto/logging"
 	"progetto/restaurant/server/database"
 	"strconv"
 )
@@ -17,38 +18,6 @@ type AdminDashboardData struct {
 	Success      string
 }
 
-type EmailNotification struct {
-	Recipient string `json:"recipient"`
-	Subject   string `json:"subject"`
-	Body      string `json:"message"`
-}
-
-// Helper function to send email notification
-func sendEmailNotification(email, subject, body string) error {
-	notification := EmailNotification{
-		Recipient: email,
-		Subject:   subject,
-		Body:      body,
-	}
-
-	jsonData, err := json.Marshal(notification)
-	if err != nil {
-		return fmt.Errorf("error marshaling notification: %v", err)
-	}
-
-	resp, err := http.Post("http://localhost:8081/notification", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error sending notification: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("notification service returned status: %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
 // Helper function to get reservation by ID
 func getReservationByID(id int) (*database.Reservation, error) {
 	reservations, err := database.GetAllReservations()
@@ -65,15 +34,50 @@ func getReservationByID(id int) (*database.Reservation, error) {
 	return nil, fmt.Errorf("reservation not found")
 }
 
+// Helper function to build a message for the guest of a reservation, sent by
+// SMS when their account asks for it and by email otherwise. Emails carry the
+// reservation as a calendar event, or its cancellation when cancelled is true.
+func guestNotice(ctx context.Context, reservation *database.Reservation, template string, cancelled bool) database.OutboxMessage {
+	channel, recipient, err := database.GetNotificationContact(reservation.Email)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting notification preferences", "email", reservation.Email, "error", err)
+		channel, recipient = database.ChannelEmail, reservation.Email
+	}
+
+	m := database.OutboxMessage{
+		ReservationID: reservation.ID,
+		Channel:       channel,
+		Recipient:     recipient,
+		Template:      template,
+		TemplateData:  reservationTemplateData(reservation),
+		RequestID:     logging.RequestID(ctx),
+	}
+	if channel == database.ChannelEmail {
+		m.Calendar = reservationCalendarEvent(reservation, cancelled)
+	}
+	return m
+}
+
+// Helper function to build the confirmation message of a reservation, with
+// the links to confirm the attendance or cancel
+func confirmationNotice(ctx context.Context, reservation *database.Reservation) database.OutboxMessage {
+	m := guestNotice(ctx, reservation, "reservation_confirmed", false)
+	addReservationLinks(&m, reservation)
+	return m
+}
+
+// Helper function to build the rejection message of a reservation
+func rejectionNotice(ctx context.Context, reservation *database.Reservation) database.OutboxMessage {
+	return guestNotice(ctx, reservation, "reservation_rejected", true)
+}
+
 // Admin Dashboard Handler - Display dashboard with stats and reservations
 func AdminDashboardHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	if r.Method == http.MethodGet {
 		// Get admin statistics
 		stats, err := database.GetAdminStats()
 		if err != nil {
-			log.Printf("Error getting admin stats: %v", err)
+			slog.ErrorContext(r.Context(), "Error getting admin stats", "error", err)
 			http.Error(w, "Error loading dashboard", http.StatusInternalServerError)
 			return
 		}
@@ -81,7 +85,7 @@ func AdminDashboardHandler(w http.ResponseWriter, r *http.Request) {
 		// Get all reservations
 		reservations, err := database.GetAllReservations()
 		if err != nil {
-			log.Printf("Error getting reservations: %v", err)
+			slog.ErrorContext(r.Context(), "Error getting reservations", "error", err)
 			http.Error(w, "Error loading reservations", http.StatusInternalServerError)
 			return
 		}
@@ -101,8 +105,6 @@ func AdminDashboardHandler(w http.ResponseWriter, r *http.Request) {
 
 // Confirm Reservation Handler
 func ConfirmReservationHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	if r.Method == http.MethodPost {
 		idStr := r.FormValue("reservation_id")
 		if idStr == "" {
@@ -119,58 +121,30 @@ func ConfirmReservationHandler(w http.ResponseWriter, r *http.Request) {
 		// Get reservation details before confirming
 		reservation, err := getReservationByID(id)
 		if err != nil {
-			log.Printf("Error getting reservation %d: %v", id, err)
+			slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", id, "error", err)
 			http.Error(w, "Error retrieving reservation", http.StatusInternalServerError)
 			return
 		}
 
-		// Confirm the reservation
-		err = database.ConfirmReservation(id)
-		if err != nil {
-			log.Printf("Error confirming reservation %d: %v", id, err)
-			http.Error(w, "Error confirming reservation", http.StatusInternalServerError)
+		// Confirm the reservation and queue the confirmation email
+		err = database.ConfirmReservation(id, database.SourceAdmin, confirmationNotice(r.Context(), reservation))
+		if errors.Is(err, database.ErrReservationStatusChanged) {
+			http.Error(w, "Reservation is no longer pending", http.StatusConflict)
 			return
 		}
-
-		// Send confirmation email
-		subject := "Prenotazione Confermata - Crisbi's"
-		body := fmt.Sprintf(`Gentile %s,
-
-La tua prenotazione è stata confermata!
-
-Dettagli della prenotazione:
-- Data: %s
-- Orario: %s
-- Numero ospiti: %d
-- Tavolo: %d
-
-Ti aspettiamo da Crisbi's!
-
-Cordiali saluti,
-Il team di Crisbi's`,
-			reservation.Name,
-			reservation.ReservationDate,
-			reservation.ReservationTime,
-			reservation.Guests,
-			reservation.TableNumber)
-
-		err = sendEmailNotification(reservation.Email, subject, body)
 		if err != nil {
-			log.Printf("Warning: Failed to send confirmation email for reservation %d: %v", id, err)
-			// Non blocchiamo l'operazione se l'email fallisce
-		} else {
-			log.Printf("Confirmation email sent successfully for reservation %d", id)
+			slog.ErrorContext(r.Context(), "Error confirming reservation", "reservation_id", id, "error", err)
+			http.Error(w, "Error confirming reservation", http.StatusInternalServerError)
+			return
 		}
 
-		log.Printf("Reservation %d confirmed successfully", id)
+		slog.InfoContext(r.Context(), "Reservation confirmed", "reservation_id", id)
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 	}
 }
 
 // Reject Reservation Handler
 func RejectReservationHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	if r.Method == http.MethodPost {
 		idStr := r.FormValue("reservation_id")
 		if idStr == "" {
@@ -187,52 +161,116 @@ func RejectReservationHandler(w http.ResponseWriter, r *http.Request) {
 		// Get reservation details before rejecting
 		reservation, err := getReservationByID(id)
 		if err != nil {
-			log.Printf("Error getting reservation %d: %v", id, err)
+			slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", id, "error", err)
 			http.Error(w, "Error retrieving reservation", http.StatusInternalServerError)
 			return
 		}
 
-		// Reject the reservation
-		err = database.RejectReservation(id)
+		// Reject the reservation and queue the rejection email
+		err = database.RejectReservation(id, database.SourceAdmin, rejectionNotice(r.Context(), reservation))
+		if errors.Is(err, database.ErrReservationStatusChanged) {
+			http.Error(w, "Reservation is no longer pending", http.StatusConflict)
+			return
+		}
 		if err != nil {
-			log.Printf("Error rejecting reservation %d: %v", id, err)
+			slog.ErrorContext(r.Context(), "Error rejecting reservation", "reservation_id", id, "error", err)
 			http.Error(w, "Error rejecting reservation", http.StatusInternalServerError)
 			return
 		}
 
-		// Send rejection email
-		subject := "Prenotazione Non Disponibile - Crisbi's"
-		body := fmt.Sprintf(`Gentile %s,
+		slog.InfoContext(r.Context(), "Reservation rejected", "reservation_id", id)
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+	}
+}
 
-Ci dispiace informarti che non è possibile confermare la tua prenotazione.
+type UserSessions struct {
+	Username string
+	Role     string
+	Sessions []database.Session
+}
 
-Dettagli della prenotazione richiesta:
-- Data: %s
-- Orario: %s
-- Numero ospiti: %d
+type AdminSessionsData struct {
+	Users   []UserSessions
+	Error   string
+	Success string
+}
 
-Motivo: Disponibilità esaurita per la data e l'orario richiesti.
+// Group sessions by user, keeping the order returned by the database
+func groupSessionsByUser(sessions []database.Session) []UserSessions {
+	var users []UserSessions
+	for _, s := range sessions {
+		if len(users) == 0 || users[len(users)-1].Username != s.Username {
+			users = append(users, UserSessions{Username: s.Username, Role: s.Role})
+		}
+		last := &users[len(users)-1]
+		last.Sessions = append(last.Sessions, s)
+	}
+	return users
+}
 
-Ti invitiamo a contattarci per trovare una soluzione alternativa o a effettuare una nuova prenotazione per un'altra data.
+// Admin Sessions Handler - List active sessions per user
+func AdminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		sessions, err := database.GetActiveSessions()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting active sessions", "error", err)
+			http.Error(w, "Error loading sessions", http.StatusInternalServerError)
+			return
+		}
 
-Ci scusiamo per l'inconveniente.
+		data := AdminSessionsData{Users: groupSessionsByUser(sessions)}
 
-Cordiali saluti,
-Il team di Crisbi's`,
-			reservation.Name,
-			reservation.ReservationDate,
-			reservation.ReservationTime,
-			reservation.Guests)
+		switch r.URL.Query().Get("revoked") {
+		case "session":
+			data.Success = "Sessione revocata."
+		case "user":
+			data.Success = "Tutte le sessioni dell'utente sono state revocate."
+		}
 
-		err = sendEmailNotification(reservation.Email, subject, body)
+		err = templates.ExecuteTemplate(w, "adminSessions.html", data)
 		if err != nil {
-			log.Printf("Warning: Failed to send rejection email for reservation %d: %v", id, err)
-			// Non blocchiamo l'operazione se l'email fallisce
-		} else {
-			log.Printf("Rejection email sent successfully for reservation %d", id)
+			http.Error(w, "Error rendering sessions page", http.StatusInternalServerError)
+			return
 		}
+	}
+}
 
-		log.Printf("Reservation %d rejected successfully", id)
-		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+// Revoke Session Handler - Revoke a single session
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("session_id"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.RevokeSession(id); err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking session", "session_id", id, "error", err)
+			http.Error(w, "Error revoking session", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Session revoked", "session_id", id)
+		http.Redirect(w, r, "/admin/sessions?revoked=session", http.StatusSeeOther)
+	}
+}
+
+// Revoke User Sessions Handler - Revoke every session of a user
+func RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		username := r.FormValue("username")
+		if username == "" {
+			http.Error(w, "Missing username", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.RevokeUserSessions(username); err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking sessions", "username", username, "error", err)
+			http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "All sessions revoked", "username", username)
+		http.Redirect(w, r, "/admin/sessions?revoked=user", http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type APIStats struct {
+	TodayReservations   int `json:"today_reservations"`
+	PendingReservations int `json:"pending_reservations"`
+	AvailableTables     int `json:"available_tables"`
+}
+
+type APISession struct {
+	ID         int       `json:"id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Persistent bool      `json:"persistent"`
+}
+
+// Helper function to load the reservation in the URL for an admin action
+func getAPIReservation(w http.ResponseWriter, r *http.Request) (*database.Reservation, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Invalid reservation ID")
+		return nil, false
+	}
+
+	reservation, err := database.GetReservation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondAPIError(w, http.StatusNotFound, apiErrNotFound, "Reservation not found")
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", id, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservation")
+		return nil, false
+	}
+	return reservation, true
+}
+
+// API Stats Handler - Dashboard statistics
+func APIAdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := database.GetAdminStats()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting admin stats", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving statistics")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIStats{
+		TodayReservations:   stats.TodayReservations,
+		PendingReservations: stats.PendingReservations,
+		AvailableTables:     stats.AvailableTables,
+	})
+}
+
+// API Admin Reservations Handler - All reservations, optionally filtered by
+// status and date
+func APIAdminReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	date := r.URL.Query().Get("date")
+
+	reservations, err := database.GetAllReservations()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservations", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservations")
+		return
+	}
+
+	var filtered []database.Reservation
+	for _, reservation := range reservations {
+		if status != "" && reservation.Status != status {
+			continue
+		}
+		if date != "" && reservation.ReservationDate != date {
+			continue
+		}
+		filtered = append(filtered, reservation)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{"reservations": toAPIReservations(filtered)})
+}
+
+// API Confirm Reservation Handler - Confirm a reservation and notify the guest
+func APIConfirmReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getAPIReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.ConfirmReservation(reservation.ID, database.SourceAPI, confirmationNotice(r.Context(), reservation))
+	if errors.Is(err, database.ErrReservationStatusChanged) {
+		respondAPIError(w, http.StatusConflict, apiErrConflict, "Reservation is no longer pending")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error confirming reservation", "reservation_id", reservation.ID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error confirming reservation")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation confirmed", "reservation_id", reservation.ID)
+	reservation.Status = "confirmed"
+	respondJSON(w, http.StatusOK, toAPIReservation(*reservation))
+}
+
+// API Reject Reservation Handler - Reject a reservation and notify the guest
+func APIRejectReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getAPIReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.RejectReservation(reservation.ID, database.SourceAPI, rejectionNotice(r.Context(), reservation))
+	if errors.Is(err, database.ErrReservationStatusChanged) {
+		respondAPIError(w, http.StatusConflict, apiErrConflict, "Reservation is no longer pending")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rejecting reservation", "reservation_id", reservation.ID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error rejecting reservation")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation rejected", "reservation_id", reservation.ID)
+	reservation.Status = "rejected"
+	respondJSON(w, http.StatusOK, toAPIReservation(*reservation))
+}
+
+// API Sessions Handler - Active sessions of every user
+func APIAdminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := database.GetActiveSessions()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting active sessions", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving sessions")
+		return
+	}
+
+	result := []APISession{}
+	for _, s := range sessions {
+		result = append(result, APISession{
+			ID:         s.ID,
+			Username:   s.Username,
+			Role:       s.Role,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Persistent: s.Persistent,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"sessions": result})
+}
+
+// API Revoke Session Handler - Revoke a single session
+func APIRevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Invalid session ID")
+		return
+	}
+
+	if err := database.RevokeSession(id); err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking session", "session_id", id, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error revoking session")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Session revoked", "session_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// API Revoke User Sessions Handler - Revoke every session of a user
+func APIRevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	if err := database.RevokeUserSessions(username); err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking sessions", "username", username, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error revoking sessions")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "All sessions revoked", "username", username)
+	w.WriteHeader(http.StatusNoContent)
+}
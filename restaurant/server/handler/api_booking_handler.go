@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type APIReservation struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	Date            string `json:"date"`
+	Time            string `json:"time"`
+	Guests          int    `json:"guests"`
+	Tables          []int  `json:"tables"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Status          string `json:"status"`
+	CanChange       bool   `json:"can_change"`
+	// The guest confirmed they are coming
+	AttendanceConfirmed bool `json:"attendance_confirmed"`
+}
+
+type APIReservationRequest struct {
+	Date   string `json:"date"`
+	Time   string `json:"time"`
+	Guests int    `json:"guests"`
+}
+
+type APIPeriodSlots struct {
+	Name  string   `json:"name"`
+	Times []string `json:"times"`
+}
+
+type APIAvailability struct {
+	Date      string           `json:"date"`
+	Guests    int              `json:"guests"`
+	MaxGuests int              `json:"max_guests"`
+	Periods   []APIPeriodSlots `json:"periods"`
+	Notice    string           `json:"notice,omitempty"`
+	Message   string           `json:"message,omitempty"`
+}
+
+// Helper function to convert a reservation to its API representation
+func toAPIReservation(reservation database.Reservation) APIReservation {
+	canChange := canChangeReservation(&reservation) == nil
+	tables := reservation.Tables
+	if tables == nil {
+		tables = []int{}
+	}
+	return APIReservation{
+		ID:                  reservation.ID,
+		Name:                reservation.Name,
+		Email:               reservation.Email,
+		Date:                reservation.ReservationDate,
+		Time:                reservation.ReservationTime,
+		Guests:              reservation.Guests,
+		Tables:              tables,
+		DurationMinutes:     reservation.DurationMinutes,
+		Status:              reservation.Status,
+		CanChange:           canChange,
+		AttendanceConfirmed: reservation.AttendanceConfirmed,
+	}
+}
+
+// Helper function to convert a list of reservations, never returning null
+func toAPIReservations(reservations []database.Reservation) []APIReservation {
+	result := []APIReservation{}
+	for _, r := range reservations {
+		result = append(result, toAPIReservation(r))
+	}
+	return result
+}
+
+// Helper function to check the guests of a request against the largest table
+// or table group, which is returned. Writes the error response and returns
+// false when invalid.
+func validateAPIGuests(w http.ResponseWriter, r *http.Request, guests int) (int, bool) {
+	maxGuests, err := database.GetMaxPartySize()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting max party size", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving tables")
+		return 0, false
+	}
+	if guests < 1 || guests > maxGuests {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, fmt.Sprintf("guests must be between 1 and %d", maxGuests))
+		return 0, false
+	}
+	return maxGuests, true
+}
+
+// Helper function to load the reservation in the URL. Reservations of other
+// users are reported as not found.
+func getOwnedAPIReservation(w http.ResponseWriter, r *http.Request) (*database.Reservation, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Invalid reservation ID")
+		return nil, false
+	}
+
+	_, _, email, err := database.GetUserInformation(getAPIUser(r).Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving user info", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving user information")
+		return nil, false
+	}
+
+	reservation, err := database.GetReservation(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && reservation.Email != email) {
+		respondAPIError(w, http.StatusNotFound, apiErrNotFound, "Reservation not found")
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", id, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservation")
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// API Availability Handler - Available slots of a date for a party size
+func APIAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	guests, err := strconv.Atoi(r.URL.Query().Get("guests"))
+	if date == "" || err != nil {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "date and guests query parameters are required")
+		return
+	}
+	maxGuests, ok := validateAPIGuests(w, r, guests)
+	if !ok {
+		return
+	}
+
+	bookingDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "Invalid date.")
+		return
+	}
+	if bookingDate.Before(time.Now().Truncate(24 * time.Hour)) {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "The date is in the past.")
+		return
+	}
+
+	availability := APIAvailability{
+		Date:      date,
+		Guests:    guests,
+		MaxGuests: maxGuests,
+		Periods:   []APIPeriodSlots{},
+	}
+
+	closures, err := database.GetClosuresForDate(date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting closures", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving closures")
+		return
+	}
+
+	var partialClosures []string
+	for _, c := range closures {
+		if c.FullDay() {
+			availability.Message = fmt.Sprintf("The restaurant is closed on %s %s.", date, describeClosureInEnglish(c))
+			respondJSON(w, http.StatusOK, availability)
+			return
+		}
+		partialClosures = append(partialClosures, describeClosureInEnglish(c))
+	}
+	if len(partialClosures) > 0 {
+		availability.Notice = "On this date the restaurant is closed " + strings.Join(partialClosures, ", ") + "."
+	}
+
+	periods, availableTimes, err := loadAvailableSlots(date, guests, 0)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting available time slots", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving available time slots")
+		return
+	}
+
+	for _, p := range periods {
+		availability.Periods = append(availability.Periods, APIPeriodSlots{Name: p.Name, Times: p.Times})
+	}
+	if len(availableTimes) == 0 {
+		availability.Message = "No table is available for this date and number of guests."
+	}
+
+	respondJSON(w, http.StatusOK, availability)
+}
+
+// API List Reservations Handler - Reservations of the authenticated client
+func APIListReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	_, _, email, err := database.GetUserInformation(getAPIUser(r).Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving user info", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving user information")
+		return
+	}
+
+	reservations, err := database.GetUserReservations(email)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving reservations", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservations")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{"reservations": toAPIReservations(reservations)})
+}
+
+// API Create Reservation Handler - Book a table for the authenticated client
+func APICreateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIReservationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Date == "" || req.Time == "" {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "date and time are required")
+		return
+	}
+	if _, ok := validateAPIGuests(w, r, req.Guests); !ok {
+		return
+	}
+	if message := validateBookingSlot(req.Date, req.Time, req.Guests); message != nil {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, message.English)
+		return
+	}
+
+	firstName, lastName, email, err := database.GetUserInformation(getAPIUser(r).Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving user info", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving user information")
+		return
+	}
+
+	reservationID, tables, err := database.BookTable(firstName+" "+lastName, email, req.Date, req.Time, req.Guests)
+	if errors.Is(err, database.ErrNoAvailableTable) {
+		respondAPIError(w, http.StatusConflict, apiErrSlotUnavailable, "This time is no longer available. Choose another time.")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating reservation", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error creating reservation")
+		return
+	}
+
+	reservation, err := database.GetReservation(int(reservationID))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", reservationID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservation")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation created", "reservation_id", reservationID, "tables", tables)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservationID))
+	respondJSON(w, http.StatusCreated, toAPIReservation(*reservation))
+}
+
+// API Get Reservation Handler - One reservation of the authenticated client
+func APIGetReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getOwnedAPIReservation(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, toAPIReservation(*reservation))
+}
+
+// API Modify Reservation Handler - Move a reservation of the authenticated
+// client. Omitted fields keep their current value.
+func APIModifyReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getOwnedAPIReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if message := canChangeReservation(reservation); message != nil {
+		respondAPIError(w, http.StatusConflict, apiErrChangeNotAllowed, message.English)
+		return
+	}
+
+	req := APIReservationRequest{
+		Date:   reservation.ReservationDate,
+		Time:   reservation.ReservationTime,
+		Guests: reservation.Guests,
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if _, ok := validateAPIGuests(w, r, req.Guests); !ok {
+		return
+	}
+	if message := validateBookingSlot(req.Date, req.Time, req.Guests); message != nil {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, message.English)
+		return
+	}
+
+	tables, err := database.ModifyReservation(reservation.ID, req.Date, req.Time, req.Guests, database.SourceAPI,
+		modificationNotices(r.Context(), reservation, req.Date, req.Time, req.Guests))
+	if errors.Is(err, database.ErrReservationStatusChanged) {
+		respondAPIError(w, http.StatusConflict, apiErrChangeNotAllowed, "Reservation is no longer active")
+		return
+	}
+	if errors.Is(err, database.ErrNoAvailableTable) {
+		respondAPIError(w, http.StatusConflict, apiErrSlotUnavailable, "This time is no longer available. Choose another time.")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error modifying reservation", "reservation_id", reservation.ID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error modifying reservation")
+		return
+	}
+
+	updated, err := database.GetReservation(reservation.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", reservation.ID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving reservation")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation modified by the guest", "reservation_id", reservation.ID, "date", req.Date, "time", req.Time, "guests", req.Guests, "tables", tables)
+	respondJSON(w, http.StatusOK, toAPIReservation(*updated))
+}
+
+// API Cancel Reservation Handler - Cancel a reservation of the authenticated client
+func APICancelReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getOwnedAPIReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if message := canChangeReservation(reservation); message != nil {
+		respondAPIError(w, http.StatusConflict, apiErrChangeNotAllowed, message.English)
+		return
+	}
+
+	err := database.CancelReservation(reservation.ID, database.SourceAPI, cancellationNotice(r.Context(), reservation), guestCancellationNotice(r.Context(), reservation))
+	if errors.Is(err, database.ErrReservationStatusChanged) {
+		respondAPIError(w, http.StatusConflict, apiErrChangeNotAllowed, "Reservation is no longer active")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error canceling reservation", "reservation_id", reservation.ID, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error canceling reservation")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation canceled by the guest", "reservation_id", reservation.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type APIRegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+type APILoginRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+type APILoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+}
+
+type APIAccount struct {
+	Username            string `json:"username"`
+	FirstName           string `json:"first_name"`
+	LastName            string `json:"last_name"`
+	Email               string `json:"email"`
+	Phone               string `json:"phone"`
+	NotificationChannel string `json:"notification_channel"`
+	Role                string `json:"role"`
+}
+
+// Omitted notification preferences keep their current value
+type APIAccountUpdate struct {
+	FirstName           string  `json:"first_name"`
+	LastName            string  `json:"last_name"`
+	Email               string  `json:"email"`
+	Phone               *string `json:"phone"`
+	NotificationChannel *string `json:"notification_channel"`
+}
+
+type APIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type APIKeyInfo struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// API Register Handler - Create a client account
+func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIRegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Username == "" || req.Password == "" || req.Email == "" {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "username, password and email are required")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Internal server error")
+		return
+	}
+
+	err = database.RegisterUser(req.Username, string(hashedPassword), req.Email, "client")
+	if errors.Is(err, database.ErrAccountExists) {
+		respondAPIError(w, http.StatusConflict, apiErrConflict, "Username or email already exists")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error registering user", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error registering user")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, APIAccount{
+		Username:            req.Username,
+		Email:               req.Email,
+		NotificationChannel: database.ChannelEmail,
+		Role:                "client",
+	})
+}
+
+// API Login Handler - Exchange credentials for a bearer token
+func APILoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req APILoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	hashedPassword, role, err := database.GetUserCredentials(req.Username)
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password))
+	}
+	if err != nil {
+		respondAPIError(w, http.StatusUnauthorized, apiErrUnauthorized, "Invalid username or password")
+		return
+	}
+
+	token, err := generateSessionToken()
+	if err != nil {
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Internal server error")
+		return
+	}
+
+	expiresAt, err := database.SaveSessionToken(req.Username, token, req.RememberMe)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving session token", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APILoginResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+		Username:  req.Username,
+		Role:      role,
+	})
+}
+
+// API Logout Handler - Revoke the bearer token of the request
+func APILogoutHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+	if user.SessionToken == "" {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Requests authenticated with an API key have no session to close")
+		return
+	}
+
+	if err := database.DeleteSessionToken(user.SessionToken); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting session token", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Failed to log out")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// API Account Handler - Get the account of the authenticated user
+func APIGetAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	firstName, lastName, email, err := database.GetUserInformation(user.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving user info", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving account")
+		return
+	}
+
+	if firstName == "Missing" {
+		firstName = ""
+	}
+	if lastName == "Missing" {
+		lastName = ""
+	}
+
+	channel, phone, err := database.GetNotificationPreferences(user.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting notification preferences", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving account")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIAccount{
+		Username:            user.Username,
+		FirstName:           firstName,
+		LastName:            lastName,
+		Email:               email,
+		Phone:               phone,
+		NotificationChannel: channel,
+		Role:                user.Role,
+	})
+}
+
+// API Update Account Handler - Update name and email of the authenticated user
+func APIUpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	var req APIAccountUpdate
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Email == "" {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "email is required")
+		return
+	}
+
+	channel, phone, err := database.GetNotificationPreferences(user.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting notification preferences", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error updating account")
+		return
+	}
+	if req.NotificationChannel != nil {
+		channel = *req.NotificationChannel
+	}
+	if req.Phone != nil {
+		phone = *req.Phone
+	}
+	if message := validateNotificationPreferences(channel, phone); message != nil {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, message.English)
+		return
+	}
+
+	if err := database.UpdateInformation(user.Username, req.FirstName, req.LastName, req.Email); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating account", "error", err)
+		respondAPIError(w, http.StatusConflict, apiErrConflict, "Email already in use")
+		return
+	}
+
+	if err := database.UpdateNotificationPreferences(user.Username, channel, phone); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating notification preferences", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error updating account")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIAccount{
+		Username:            user.Username,
+		FirstName:           req.FirstName,
+		LastName:            req.LastName,
+		Email:               req.Email,
+		Phone:               phone,
+		NotificationChannel: channel,
+		Role:                user.Role,
+	})
+}
+
+// API Delete Account Handler - Delete the authenticated user
+func APIDeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	if err := database.RevokeUserSessions(user.Username); err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking sessions", "username", user.Username, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error deleting account")
+		return
+	}
+
+	if err := database.DeleteUser(user.Username); err != nil {
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error deleting account")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// API Keys Handler - List the API keys of the authenticated user
+func APIListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	keys, err := database.GetUserAPIKeys(user.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting API keys", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error retrieving API keys")
+		return
+	}
+
+	infos := []APIKeyInfo{}
+	for _, k := range keys {
+		infos = append(infos, APIKeyInfo{
+			ID:         k.ID,
+			Name:       k.Name,
+			Prefix:     k.Prefix,
+			CreatedAt:  k.CreatedAt,
+			LastUsedAt: k.LastUsedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"api_keys": infos})
+}
+
+// API Create Key Handler - Create an API key; the key is only returned here
+func APICreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	var req APIKeyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondAPIError(w, http.StatusUnprocessableEntity, apiErrValidation, "name is required")
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Internal server error")
+		return
+	}
+
+	id, err := database.SaveAPIKey(user.Username, req.Name, key)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving API key", "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error creating API key")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key created", "api_key_id", id, "username", user.Username)
+	respondJSON(w, http.StatusCreated, APIKeyInfo{
+		ID:        int(id),
+		Name:      req.Name,
+		Prefix:    key[:8],
+		CreatedAt: time.Now().UTC(),
+		Key:       key,
+	})
+}
+
+// API Revoke Key Handler - Revoke an API key of the authenticated user
+func APIRevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPIUser(r)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = database.RevokeAPIKey(user.Username, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondAPIError(w, http.StatusNotFound, apiErrNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking API key", "api_key_id", id, "error", err)
+		respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error revoking API key")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key revoked", "api_key_id", id, "username", user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"progetto/restaurant/server/database"
+	"strings"
+)
+
+// Machine readable error codes of the JSON API
+const (
+	apiErrBadRequest       = "bad_request"
+	apiErrValidation       = "validation_failed"
+	apiErrUnauthorized     = "unauthorized"
+	apiErrForbidden        = "forbidden"
+	apiErrNotFound         = "not_found"
+	apiErrMethodNotAllowed = "method_not_allowed"
+	apiErrConflict         = "conflict"
+	apiErrSlotUnavailable  = "slot_unavailable"
+	apiErrChangeNotAllowed = "change_not_allowed"
+	apiErrInternal         = "internal_error"
+)
+
+// Maximum size of a JSON request body
+const apiMaxBodyBytes = 1 << 20
+
+// Error envelope returned by every failing API call
+type APIError struct {
+	Error APIErrorBody `json:"error"`
+}
+
+type APIErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// User authenticated by the API middleware. SessionToken is empty when the
+// request was authenticated with an API key.
+type apiUser struct {
+	Username     string
+	Role         string
+	SessionToken string
+}
+
+type apiUserKey struct{}
+
+// Helper function to write an error envelope
+func respondAPIError(w http.ResponseWriter, status int, code, message string) {
+	respondJSON(w, status, APIError{Error: APIErrorBody{Code: code, Message: message}})
+}
+
+// Helper function to decode a JSON request body, rejecting unknown fields.
+// Writes the error response and returns false when the body is invalid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Request body is empty")
+			return false
+		}
+		respondAPIError(w, http.StatusBadRequest, apiErrBadRequest, "Invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// Generate a new API key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "rk_" + hex.EncodeToString(b), nil
+}
+
+// Credentials refused by authenticateAPIRequest; any other error it returns
+// is a failure looking them up
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errInvalidCredentials = errors.New("invalid or expired credentials")
+)
+
+// Helper function to authenticate an API request, either with a session token
+// in the Authorization header or with an API key in the X-API-Key header
+func authenticateAPIRequest(r *http.Request) (*apiUser, error) {
+	var account *database.SessionUser
+	var token string
+	var err error
+
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		account, err = database.ValidateAPIKey(key)
+	} else if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && bearer != "" {
+		token = bearer
+		account, err = database.GetSessionUser(token)
+	} else {
+		return nil, errMissingCredentials
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, database.ErrSessionExpired) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &apiUser{Username: account.Username, Role: account.Role, SessionToken: token}, nil
+}
+
+// Get the user authenticated by the API middleware
+func getAPIUser(r *http.Request) *apiUser {
+	user, _ := r.Context().Value(apiUserKey{}).(*apiUser)
+	return user
+}
+
+// Middleware to authenticate API requests. An empty role accepts any user.
+func requireAPIRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := authenticateAPIRequest(r)
+		if errors.Is(err, errMissingCredentials) || errors.Is(err, errInvalidCredentials) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			respondAPIError(w, http.StatusUnauthorized, apiErrUnauthorized, "Unauthorized: "+err.Error())
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error validating API credentials", "error", err)
+			respondAPIError(w, http.StatusInternalServerError, apiErrInternal, "Error validating credentials")
+			return
+		}
+
+		if role != "" && user.Role != role {
+			respondAPIError(w, http.StatusForbidden, apiErrForbidden, "Forbidden: "+role+" access required")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiUserKey{}, user)))
+	}
+}
+
+// Middleware for API routes open to every authenticated user
+func RequireAPIUser(next http.HandlerFunc) http.HandlerFunc {
+	return requireAPIRole("", next)
+}
+
+// Middleware for API routes reserved to clients
+func RequireAPIClient(next http.HandlerFunc) http.HandlerFunc {
+	return requireAPIRole("client", next)
+}
+
+// Middleware for API routes reserved to admins
+func RequireAPIAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return requireAPIRole("admin", next)
+}
+
+// Handler for unknown API routes
+func APINotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	respondAPIError(w, http.StatusNotFound, apiErrNotFound, "Route not found")
+}
+
+// Handler for API routes called with the wrong method
+func APIMethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	respondAPIError(w, http.StatusMethodNotAllowed, apiErrMethodNotAllowed, "Method not allowed")
+}
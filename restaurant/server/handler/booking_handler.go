@@ -2,166 +2,292 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"progetto/restaurant/server/database"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type BookingPageData struct {
+	ReservationID  int
 	Error          string
+	Notice         string
 	Success        string
 	Date           string
 	Guests         int
+	MaxGuests      int
 	AvailableTimes []string
-	LunchTimes     []string
-	DinnerTimes    []string
+	Periods        []database.PeriodSlots
+}
+
+// Helper function to get the largest bookable party. Writes the error
+// response and returns false when it cannot be read.
+func maxPartySize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	maxGuests, err := database.GetMaxPartySize()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting max party size", "error", err)
+		http.Error(w, "Error retrieving tables", http.StatusInternalServerError)
+		return 0, false
+	}
+	return maxGuests, true
 }
 
 // Helper function to render booking page with data
 func renderBookingPage(w http.ResponseWriter, data BookingPageData) {
+	if data.MaxGuests == 0 {
+		maxGuests, err := database.GetMaxPartySize()
+		if err != nil {
+			slog.Error("Error getting max party size", "error", err)
+			http.Error(w, "Error retrieving tables", http.StatusInternalServerError)
+			return
+		}
+		data.MaxGuests = maxGuests
+	}
 	err := templates.ExecuteTemplate(w, "booking.html", data)
 	if err != nil {
-		log.Printf("Error rendering booking page: %v", err)
+		slog.Error("Error rendering booking page", "error", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 	}
 }
 
-// Helper function to separate lunch and dinner times
-func separateLunchDinner(times []string) ([]string, []string) {
-	lunchTimes := []string{}
-	dinnerTimes := []string{}
-
-	for _, t := range times {
-		hour := 0
-		_, err := fmt.Sscanf(t, "%d:", &hour)
-		if err == nil {
-			if hour >= 12 && hour < 15 {
-				lunchTimes = append(lunchTimes, t)
-			} else if hour >= 19 {
-				dinnerTimes = append(dinnerTimes, t)
+// Helper function to get the available slots of a date grouped by service
+// period, dropping the slots already passed when the date is today.
+// excludeID is the reservation being modified, if any.
+func loadAvailableSlots(date string, guests, excludeID int) ([]database.PeriodSlots, []string, error) {
+	var periods []database.PeriodSlots
+	var err error
+	if excludeID != 0 {
+		periods, err = database.GetAvailableSlotsForChange(excludeID, date, guests)
+	} else {
+		periods, err = database.GetAvailableSlotsByPeriod(date, guests)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	isToday := date == now.Format("2006-01-02")
+
+	var filteredPeriods []database.PeriodSlots
+	var availableTimes []string
+	for _, period := range periods {
+		var times []string
+		for _, t := range period.Times {
+			if isToday {
+				bookingTime, err := time.Parse("15:04", t)
+				if err != nil {
+					continue
+				}
+				bookingDateTime := time.Date(now.Year(), now.Month(), now.Day(),
+					bookingTime.Hour(), bookingTime.Minute(), 0, 0, now.Location())
+
+				if !bookingDateTime.After(now) {
+					continue
+				}
 			}
+			times = append(times, t)
+		}
+		if len(times) > 0 {
+			filteredPeriods = append(filteredPeriods, database.PeriodSlots{Name: period.Name, Times: times})
+			availableTimes = append(availableTimes, times...)
 		}
 	}
 
-	return lunchTimes, dinnerTimes
+	return filteredPeriods, availableTimes, nil
 }
 
-// Booking page handler - Step 1: Show form for date and guests
-func BookingPageHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
+// Helper function to describe the service periods of a date, e.g. "Pranzo (12:00-14:30), Cena (19:00-22:00)"
+func describeServicePeriods(date string) string {
+	periods, err := database.GetServicePeriodsForDate(date)
+	if err != nil {
+		return ""
+	}
 
-	if r.Method == http.MethodGet {
-		renderBookingPage(w, BookingPageData{})
+	descriptions := make([]string, len(periods))
+	for i, p := range periods {
+		descriptions[i] = fmt.Sprintf("%s (%s-%s)", p.Name, p.StartTime, p.LastSeating)
 	}
+	return strings.Join(descriptions, ", ")
 }
 
-// Booking Step 1 Handler - Process date and guests, show available times
-func BookingStep1Handler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
+// Helper function to describe a closure to the guest, e.g. "dalle 12:00 alle 15:00 (Evento privato)"
+func describeClosure(c database.Closure) string {
+	description := "tutto il giorno"
+	if !c.FullDay() {
+		description = fmt.Sprintf("dalle %s alle %s", c.StartTime, c.EndTime)
+	}
+	if c.Reason != "" {
+		description += " (" + c.Reason + ")"
+	}
+	return description
+}
 
-	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/booking", http.StatusSeeOther)
-		return
+// Helper function to describe a closure in English for the API, e.g.
+// "from 12:00 to 15:00 (Evento privato)"
+func describeClosureInEnglish(c database.Closure) string {
+	description := "all day"
+	if !c.FullDay() {
+		description = fmt.Sprintf("from %s to %s", c.StartTime, c.EndTime)
+	}
+	if c.Reason != "" {
+		description += " (" + c.Reason + ")"
 	}
+	return description
+}
 
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		log.Printf("Error parsing form: %v", err)
-		renderBookingPage(w, BookingPageData{Error: "Errore nel form. Riprova."})
-		return
+// Helper function to check that a slot can be booked: not in the past, inside
+// the opening hours and not overlapping a closure for the time the party
+// stays. Returns the message to show to the guest, or nil when the slot is
+// valid.
+func validateBookingSlot(date, timeSlot string, guests int) *guestMessage {
+	// Validate date (not in the past)
+	bookingDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return &guestMessage{"Data non valida.", "Invalid date."}
 	}
 
-	// Get form values
-	date := r.FormValue("date")
-	guestsStr := r.FormValue("guests")
+	today := time.Now().Truncate(24 * time.Hour)
+	now := time.Now()
 
-	// Validate form values
-	if date == "" || guestsStr == "" {
-		renderBookingPage(w, BookingPageData{Error: "Tutti i campi sono obbligatori."})
-		return
+	if bookingDate.Before(today) {
+		return &guestMessage{"Non puoi prenotare per una data passata.", "The date is in the past."}
 	}
 
-	// Parse guests
-	guests, err := strconv.Atoi(guestsStr)
-	if err != nil || guests < 1 || guests > 6 {
-		renderBookingPage(w, BookingPageData{Error: "Numero di ospiti non valido (1-6)."})
-		return
+	// Validate time format
+	bookingTime, err := time.Parse("15:04", timeSlot)
+	if err != nil {
+		return &guestMessage{"Orario non valido.", "Invalid time."}
 	}
 
+	// Check if booking is for today and time has already passed
+	if bookingDate.Equal(today) {
+		bookingDateTime := time.Date(now.Year(), now.Month(), now.Day(),
+			bookingTime.Hour(), bookingTime.Minute(), 0, 0, now.Location())
+
+		if bookingDateTime.Before(now) {
+			return &guestMessage{"Non puoi prenotare per un orario già passato.", "The time has already passed."}
+		}
+	}
+
+	// Check if time is one of the slots of the opening hours
+	_, validSlot, err := database.FindServicePeriod(date, timeSlot)
+	if err != nil {
+		slog.Error("Error checking service periods", "error", err)
+		return &guestMessage{"Errore nel recupero degli orari di apertura.", "Error retrieving the opening hours."}
+	}
+	if !validSlot {
+		if periods := describeServicePeriods(date); periods != "" {
+			return &guestMessage{"Orario non valido. Scegli tra: " + periods + ".", "The time is outside the opening hours: " + periods + "."}
+		}
+		return &guestMessage{"Orario non valido. Il ristorante è chiuso in questa data.", "The restaurant is closed on this date."}
+	}
+
+	// Check that the restaurant is not closed while the party is at the table
+	duration, err := database.GetDiningDurationForSlot(date, timeSlot, guests)
+	if err != nil {
+		slog.Error("Error getting dining duration", "error", err)
+		return &guestMessage{"Errore nel recupero della durata della prenotazione.", "Error retrieving the dining duration."}
+	}
+	closures, err := database.GetClosuresForDate(date)
+	if err != nil {
+		slog.Error("Error getting closures", "error", err)
+		return &guestMessage{"Errore nel recupero dei giorni di chiusura.", "Error retrieving the closures."}
+	}
+	if closure, closed := database.FindClosure(closures, timeSlot, duration); closed {
+		return &guestMessage{
+			"Il ristorante è chiuso " + describeClosure(closure) + ". Scegli un'altra data o un altro orario.",
+			"The restaurant is closed " + describeClosureInEnglish(closure) + ".",
+		}
+	}
+
+	return nil
+}
+
+// Helper function to build step 2 of the booking page: the available slots
+// of a date, with closures explained to the guest. excludeID is the
+// reservation being modified, if any.
+func availableSlotsPage(date string, guests, excludeID int) BookingPageData {
 	// Validate date (not in the past)
 	bookingDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		renderBookingPage(w, BookingPageData{Error: "Data non valida."})
-		return
+		return BookingPageData{Error: "Data non valida."}
 	}
 
 	today := time.Now().Truncate(24 * time.Hour)
 	if bookingDate.Before(today) {
-		renderBookingPage(w, BookingPageData{
+		return BookingPageData{
 			Error:  "Non puoi prenotare per una data passata.",
 			Date:   date,
 			Guests: guests,
-		})
-		return
+		}
 	}
 
-	// Get available time slots
-	availableTimes, err := database.GetAvailableTimeSlots(date, guests)
+	// Check closures for the requested date
+	closures, err := database.GetClosuresForDate(date)
 	if err != nil {
-		log.Printf("Error getting available time slots: %v", err)
-		renderBookingPage(w, BookingPageData{
-			Error:  "Errore nel recupero degli orari disponibili.",
+		slog.Error("Error getting closures", "error", err)
+		return BookingPageData{
+			Error:  "Errore nel recupero dei giorni di chiusura.",
 			Date:   date,
 			Guests: guests,
-		})
-		return
+		}
 	}
 
-	// Filter out past times if booking is for today
-	if bookingDate.Equal(today) {
-		now := time.Now()
-		var filteredTimes []string
-		for _, t := range availableTimes {
-			bookingTime, err := time.Parse("15:04", t)
-			if err != nil {
-				continue
-			}
-			bookingDateTime := time.Date(now.Year(), now.Month(), now.Day(),
-				bookingTime.Hour(), bookingTime.Minute(), 0, 0, now.Location())
-
-			if bookingDateTime.After(now) {
-				filteredTimes = append(filteredTimes, t)
+	var partialClosures []string
+	for _, c := range closures {
+		if c.FullDay() {
+			return BookingPageData{
+				Error:  fmt.Sprintf("Il ristorante è chiuso il %s %s. Scegli un'altra data.", date, describeClosure(c)),
+				Date:   date,
+				Guests: guests,
 			}
 		}
-		availableTimes = filteredTimes
+		partialClosures = append(partialClosures, describeClosure(c))
 	}
 
-	// Separate lunch and dinner times
-	lunchTimes, dinnerTimes := separateLunchDinner(availableTimes)
+	// Get available time slots, grouped by service period
+	periods, availableTimes, err := loadAvailableSlots(date, guests, excludeID)
+	if err != nil {
+		slog.Error("Error getting available time slots", "error", err)
+		return BookingPageData{
+			Error:  "Errore nel recupero degli orari disponibili.",
+			Date:   date,
+			Guests: guests,
+		}
+	}
 
 	// Show step 2 with available times
 	data := BookingPageData{
 		Date:           date,
 		Guests:         guests,
 		AvailableTimes: availableTimes,
-		LunchTimes:     lunchTimes,
-		DinnerTimes:    dinnerTimes,
+		Periods:        periods,
+	}
+
+	if len(partialClosures) > 0 {
+		data.Notice = "In questa data il ristorante è chiuso " + strings.Join(partialClosures, ", ") + "."
 	}
 
 	if len(availableTimes) == 0 {
 		data.Error = "Nessun tavolo disponibile per questa data e numero di ospiti. Prova un'altra data."
 	}
 
-	renderBookingPage(w, data)
+	return data
 }
 
-// Create booking handler - Final step: Create the reservation
-func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
+// Booking page handler - Step 1: Show form for date and guests
+func BookingPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		renderBookingPage(w, BookingPageData{})
+	}
+}
 
+// Booking Step 1 Handler - Process date and guests, show available times
+func BookingStep1Handler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/booking", http.StatusSeeOther)
 		return
@@ -169,214 +295,151 @@ func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
-		log.Printf("Error parsing form: %v", err)
+		slog.ErrorContext(r.Context(), "Error parsing form", "error", err)
 		renderBookingPage(w, BookingPageData{Error: "Errore nel form. Riprova."})
 		return
 	}
 
 	// Get form values
 	date := r.FormValue("date")
-	timeSlot := r.FormValue("time")
 	guestsStr := r.FormValue("guests")
 
 	// Validate form values
-	if date == "" || timeSlot == "" || guestsStr == "" {
+	if date == "" || guestsStr == "" {
 		renderBookingPage(w, BookingPageData{Error: "Tutti i campi sono obbligatori."})
 		return
 	}
 
 	// Parse guests
-	guests, err := strconv.Atoi(guestsStr)
-	if err != nil || guests < 1 || guests > 6 {
-		renderBookingPage(w, BookingPageData{Error: "Numero di ospiti non valido (1-6)."})
+	maxGuests, ok := maxPartySize(w, r)
+	if !ok {
 		return
 	}
-
-	// Validate date (not in the past)
-	bookingDate, err := time.Parse("2006-01-02", date)
-	if err != nil {
-		renderBookingPage(w, BookingPageData{Error: "Data non valida."})
+	guests, err := strconv.Atoi(guestsStr)
+	if err != nil || guests < 1 || guests > maxGuests {
+		renderBookingPage(w, BookingPageData{Error: fmt.Sprintf("Numero di ospiti non valido (1-%d).", maxGuests)})
 		return
 	}
 
-	today := time.Now().Truncate(24 * time.Hour)
-	now := time.Now()
+	renderBookingPage(w, availableSlotsPage(date, guests, 0))
+}
 
-	if bookingDate.Before(today) {
-		renderBookingPage(w, BookingPageData{
-			Error:  "Non puoi prenotare per una data passata.",
-			Date:   date,
-			Guests: guests,
-		})
+// Create booking handler - Final step: Create the reservation
+func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
 		return
 	}
 
-	// Validate time format
-	bookingTime, err := time.Parse("15:04", timeSlot)
-	if err != nil {
-		renderBookingPage(w, BookingPageData{Error: "Orario non valido."})
+	// Parse form data
+	if err := r.ParseForm(); err != nil {
+		slog.ErrorContext(r.Context(), "Error parsing form", "error", err)
+		renderBookingPage(w, BookingPageData{Error: "Errore nel form. Riprova."})
 		return
 	}
 
-	// Check if booking is for today and time has already passed
-	if bookingDate.Equal(today) {
-		bookingDateTime := time.Date(now.Year(), now.Month(), now.Day(),
-			bookingTime.Hour(), bookingTime.Minute(), 0, 0, now.Location())
+	// Get form values
+	date := r.FormValue("date")
+	timeSlot := r.FormValue("time")
+	guestsStr := r.FormValue("guests")
 
-		if bookingDateTime.Before(now) {
-			renderBookingPage(w, BookingPageData{
-				Error: "Non puoi prenotare per un orario già passato.",
-			})
-			return
-		}
+	// Validate form values
+	if date == "" || timeSlot == "" || guestsStr == "" {
+		renderBookingPage(w, BookingPageData{Error: "Tutti i campi sono obbligatori."})
+		return
 	}
 
-	// Check if time is within valid slots
-	hourInt := bookingTime.Hour()
-	if !((hourInt >= 12 && hourInt < 15) || (hourInt >= 19 && hourInt < 23)) {
-		renderBookingPage(w, BookingPageData{
-			Error: "Orario non valido. Scegli tra pranzo (12:00-14:30) o cena (19:00-22:00).",
-		})
+	// Parse guests
+	maxGuests, ok := maxPartySize(w, r)
+	if !ok {
+		return
+	}
+	guests, err := strconv.Atoi(guestsStr)
+	if err != nil || guests < 1 || guests > maxGuests {
+		renderBookingPage(w, BookingPageData{Error: fmt.Sprintf("Numero di ospiti non valido (1-%d).", maxGuests)})
 		return
 	}
 
-	// Get username from session
-	username, err := getUsernameFromSession(r)
-	if err != nil {
-		renderBookingPage(w, BookingPageData{
-			Error: "Errore di autenticazione. Effettua nuovamente il login.",
-		})
+	// Validate date, time, opening hours and closures
+	if message := validateBookingSlot(date, timeSlot, guests); message != nil {
+		renderBookingPage(w, BookingPageData{Error: message.Italian})
 		return
 	}
 
 	// Get user info
-	firstName, lastName, email, err := database.GetUserInformation(username)
+	firstName, lastName, email, err := database.GetUserInformation(getSessionUser(r).Username)
 	if err != nil {
-		log.Printf("Error retrieving user info: %v", err)
+		slog.ErrorContext(r.Context(), "Error retrieving user info", "error", err)
 		renderBookingPage(w, BookingPageData{
 			Error: "Errore nel recupero delle informazioni utente.",
 		})
 		return
 	}
 
-	// Find available table
-	tableID, err := database.FindAvailableTables(date, timeSlot, guests)
-	if err != nil {
-		log.Printf("Error finding available table: %v", err)
+	// Find a table and create the reservation atomically
+	reservationID, tables, err := database.BookTable(
+		firstName+" "+lastName,
+		email,
+		date,
+		timeSlot,
+		guests,
+	)
+	if errors.Is(err, database.ErrNoAvailableTable) {
+		slog.InfoContext(r.Context(), "No table available", "date", date, "time", timeSlot, "guests", guests)
 
 		// Get available times again to show them
-		availableTimes, _ := database.GetAvailableTimeSlots(date, guests)
-		lunchTimes, dinnerTimes := separateLunchDinner(availableTimes)
+		periods, availableTimes, _ := loadAvailableSlots(date, guests, 0)
 
 		renderBookingPage(w, BookingPageData{
 			Error:          "Questo orario non è più disponibile. Seleziona un altro orario.",
 			Date:           date,
 			Guests:         guests,
 			AvailableTimes: availableTimes,
-			LunchTimes:     lunchTimes,
-			DinnerTimes:    dinnerTimes,
+			Periods:        periods,
 		})
 		return
 	}
-
-	// Create reservation
-	reservationID, err := database.CreateReservation(
-		firstName+" "+lastName,
-		email,
-		tableID,
-		date,
-		timeSlot,
-		guests,
-	)
 	if err != nil {
-		log.Printf("Error creating reservation: %v", err)
+		slog.ErrorContext(r.Context(), "Error creating reservation", "error", err)
 		renderBookingPage(w, BookingPageData{
 			Error: "Errore nella creazione della prenotazione. Riprova.",
 		})
 		return
 	}
 
-	log.Printf("Reservation created successfully: ID=%d, Table=%d", reservationID, tableID)
+	slog.InfoContext(r.Context(), "Reservation created", "reservation_id", reservationID, "tables", tables)
 	renderBookingPage(w, BookingPageData{
 		Success: "Prenotazione creata con successo! In attesa di conferma dall'amministratore.",
 	})
 }
 
-// Get Time slots for a specific date (API endpoint - kept for compatibility)
-func GetAvailableTimeSlotsHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
-	if r.Method != http.MethodGet {
-		respondJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
-			"success": false,
-			"message": "Method not allowed",
-		})
-		return
-	}
-
-	date := r.URL.Query().Get("date")
-	guestsStr := r.URL.Query().Get("guests")
-
-	if date == "" || guestsStr == "" {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"message": "Missing date or guests parameter",
-		})
-		return
-	}
-
-	guests, err := strconv.Atoi(guestsStr)
-	if err != nil || guests <= 0 {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"message": "Invalid guests parameter",
-		})
-		return
-	}
-
-	// Get available time slots
-	availableTimes, err := database.GetAvailableTimeSlots(date, guests)
-	if err != nil {
-		log.Printf("Error retrieving available time slots: %v", err)
-		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"success": false,
-			"message": "Error retrieving available time slots",
-		})
-		return
-	}
-
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"times":   availableTimes,
-	})
-}
-
 // Handler for displaying user's bookings
 func MyBookingsHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
-	username, err := getUsernameFromSession(r)
+	// Get user's reservations
+	reservations, err := database.GetUserReservations(getSessionUser(r).Email)
 	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		slog.ErrorContext(r.Context(), "Error getting user reservations", "error", err)
+		http.Error(w, "Error retrieving reservations", http.StatusInternalServerError)
 		return
 	}
 
-	// Get user's email
-	_, _, email, err := database.GetUserInformation(username)
-	if err != nil {
-		http.Error(w, "Error retrieving user information", http.StatusInternalServerError)
-		return
+	data := MyBookingsData{}
+	for _, reservation := range reservations {
+		canChange := canChangeReservation(&reservation) == nil
+		data.Bookings = append(data.Bookings, MyBooking{Reservation: reservation, CanChange: canChange})
 	}
 
-	// Get user's reservations
-	reservations, err := database.GetUserReservations(email)
-	if err != nil {
-		log.Printf("Error getting user reservations: %v", err)
-		http.Error(w, "Error retrieving reservations", http.StatusInternalServerError)
-		return
+	switch r.URL.Query().Get("success") {
+	case "canceled":
+		data.Success = "Prenotazione annullata."
+	case "modified":
+		data.Success = "Prenotazione modificata. In attesa di conferma dall'amministratore."
+	}
+	if r.URL.Query().Get("error") == "locked" {
+		data.Error = fmt.Sprintf("Non è più possibile modificare o annullare questa prenotazione (limite: %s prima dell'orario).", formatCutoff(cancellationCutoff))
 	}
 
-	err = templates.ExecuteTemplate(w, "myBookings.html", reservations)
+	err = templates.ExecuteTemplate(w, "myBookings.html", data)
 	if err != nil {
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"time"
+)
+
+type WeekdayOption struct {
+	Value int
+	Name  string
+}
+
+type AdminClosuresData struct {
+	Closures []database.Closure
+	Weekdays []WeekdayOption
+	Error    string
+	Success  string
+}
+
+// Helper function to redirect back to the closures page with a message
+func redirectClosures(w http.ResponseWriter, r *http.Request, key, message string) {
+	http.Redirect(w, r, "/admin/closures?"+key+"="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// Closures Handler - List closures and exceptions
+func AdminClosuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		closures, err := database.GetAllClosures()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting closures", "error", err)
+			http.Error(w, "Error loading closures", http.StatusInternalServerError)
+			return
+		}
+
+		data := AdminClosuresData{
+			Closures: closures,
+			Error:    r.URL.Query().Get("error"),
+			Success:  r.URL.Query().Get("success"),
+		}
+		for i := 1; i <= 7; i++ {
+			day := time.Weekday(i % 7)
+			data.Weekdays = append(data.Weekdays, WeekdayOption{Value: int(day), Name: database.WeekdayName(day)})
+		}
+
+		err = templates.ExecuteTemplate(w, "adminClosures.html", data)
+		if err != nil {
+			http.Error(w, "Error rendering closures page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Save Closure Handler - Create or update a closure
+func SaveClosureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		closure := database.Closure{
+			Kind:      r.FormValue("kind"),
+			Date:      r.FormValue("date"),
+			StartTime: r.FormValue("start_time"),
+			EndTime:   r.FormValue("end_time"),
+			Reason:    r.FormValue("reason"),
+		}
+
+		if closure.Kind == database.ClosureWeekly {
+			weekday, err := strconv.Atoi(r.FormValue("weekday"))
+			if err != nil {
+				redirectClosures(w, r, "error", "Giorno della settimana non valido.")
+				return
+			}
+			closure.Weekday = time.Weekday(weekday)
+		}
+
+		var err error
+		if idStr := r.FormValue("closure_id"); idStr != "" {
+			closure.ID, err = strconv.Atoi(idStr)
+			if err != nil {
+				http.Error(w, "Invalid closure ID", http.StatusBadRequest)
+				return
+			}
+			err = database.UpdateClosure(closure)
+		} else {
+			err = database.InsertClosure(closure)
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error saving closure", "error", err)
+			redirectClosures(w, r, "error", "Impossibile salvare la chiusura: "+err.Error())
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Closure saved", "kind", closure.Kind)
+		redirectClosures(w, r, "success", "Chiusura salvata.")
+	}
+}
+
+// Delete Closure Handler - Remove a closure
+func DeleteClosureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("closure_id"))
+		if err != nil {
+			http.Error(w, "Invalid closure ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.DeleteClosure(id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting closure", "closure_id", id, "error", err)
+			http.Error(w, "Error deleting closure", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Closure deleted", "closure_id", id)
+		redirectClosures(w, r, "success", "Chiusura eliminata.")
+	}
+}
@@ -7,4 +7,7 @@ type Data struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	// Channel used for the notifications: email or sms
+	NotificationChannel string `json:"notification_channel"`
 }
@@ -1,7 +1,8 @@
 package handler
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"progetto/restaurant/server/database"
 
@@ -35,19 +36,23 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		// Password hashing
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userInformation.Password), bcrypt.DefaultCost)
 		if err != nil {
-			log.Printf("Error hashing password: %v", err)
+			slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
 		// Register the user as 'client' by default
 		err = database.RegisterUser(userInformation.UserName, string(hashedPassword), userInformation.Email, "client")
-		if err != nil {
-			log.Printf("Error registering user: %v", err)
+		if errors.Is(err, database.ErrAccountExists) {
 			userInformation.Error = "Username already exists"
 			templates.ExecuteTemplate(w, "register.html", userInformation)
 			return
 		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error registering user", "error", err)
+			http.Error(w, "Error registering user", http.StatusInternalServerError)
+			return
+		}
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
@@ -67,6 +72,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
+		rememberMe := r.FormValue("remember_me") == "on"
 
 		// Get password and role together
 		hashedPassword, role, err := database.GetUserCredentials(username)
@@ -91,17 +97,14 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Save the session token in the database
-		if err := database.SaveSessionToken(username, sessionToken); err != nil {
+		expiresAt, err := database.SaveSessionToken(username, sessionToken, rememberMe)
+		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
 		// Set the session token in a cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken,
-			HttpOnly: true,
-		})
+		setSessionCookie(w, r, sessionToken, rememberMe, expiresAt)
 
 		// Redirect based on role
 		if role == "admin" {
@@ -114,8 +117,6 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 // Manage the logout request
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	if r.Method == http.MethodGet {
 		// Get the session token from the cookie
 		cookie, err := r.Cookie("session_token")
@@ -130,19 +131,12 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Set the session token cookie to an empty value
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_token",
-			Value:    "",
-			HttpOnly: true,
-			MaxAge:   -1,
-		})
+		clearSessionCookie(w, r)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
 func HomePageHandler(w http.ResponseWriter, r *http.Request) {
-	ValidateSession(w, r)
-
 	if r.Method == http.MethodGet {
 		err := templates.ExecuteTemplate(w, "home.html", nil)
 		if err != nil {
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"progetto/restaurant/server/database"
+	"time"
+)
+
+// Longest time a readiness check waits for a dependency
+const readinessTimeout = 2 * time.Second
+
+// Outcome of the health and readiness checks
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Helper function to check that the notification service answers
+func checkNotificationService(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, notificationServiceURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Health Handler - The process is up and serving requests
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Readiness Handler - The database and the notification service answer, so
+// the server can take bookings
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database":     database.PingDatabase,
+		"notification": checkNotificationService,
+	}
+
+	status := HealthStatus{Status: "ok", Checks: map[string]string{}}
+	code := http.StatusOK
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", err)
+			status.Status = "unavailable"
+			status.Checks[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[name] = "ok"
+	}
+
+	respondJSON(w, code, status)
+}
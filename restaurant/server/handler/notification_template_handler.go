@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"progetto/logging"
+	"strings"
+	"time"
+)
+
+// Returned when the notification service refuses a template; the error text
+// is its explanation
+var errTemplateRejected = errors.New("template rejected")
+
+// Template of the notification service
+type NotificationTemplate struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+type AdminTemplatesData struct {
+	Templates []string
+	Selected  *NotificationTemplate
+	Error     string
+	Success   string
+}
+
+var templatesClient = &http.Client{Timeout: 10 * time.Second}
+
+// Helper function to call the templates endpoint and decode its JSON reply
+func callTemplatesService(ctx context.Context, method, path string, payload, result any) error {
+	var jsonData []byte
+	if payload != nil {
+		var err error
+		jsonData, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error marshaling template: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, notificationServiceURL+"/templates"+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logging.HeaderRequestID, logging.RequestID(ctx))
+	if err := signNotificationRequest(req, jsonData); err != nil {
+		return fmt.Errorf("error signing request: %v", err)
+	}
+
+	resp, err := templatesClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error contacting notification service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnprocessableEntity || resp.StatusCode == http.StatusNotFound {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%w: %s", errTemplateRejected, strings.TrimSpace(string(message)))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notification service returned status: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Helper function to redirect back to the templates page with a message
+func redirectTemplates(w http.ResponseWriter, r *http.Request, name, key, message string) {
+	query := url.Values{key: {message}}
+	if name != "" {
+		query.Set("name", name)
+	}
+	http.Redirect(w, r, "/admin/templates?"+query.Encode(), http.StatusSeeOther)
+}
+
+// Helper function to render the templates page with the list of templates
+func renderAdminTemplates(w http.ResponseWriter, r *http.Request, data AdminTemplatesData) {
+	var list struct {
+		Templates []string `json:"templates"`
+	}
+	if err := callTemplatesService(r.Context(), http.MethodGet, "", nil, &list); err != nil {
+		slog.ErrorContext(r.Context(), "Error listing notification templates", "error", err)
+		if data.Error == "" {
+			data.Error = "Servizio di notifica non raggiungibile."
+		}
+	}
+	data.Templates = list.Templates
+
+	if err := templates.ExecuteTemplate(w, "adminTemplates.html", data); err != nil {
+		http.Error(w, "Error rendering templates page", http.StatusInternalServerError)
+	}
+}
+
+// Admin Templates Handler - List the notification templates and edit the
+// selected one
+func AdminTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		data := AdminTemplatesData{
+			Error:   r.URL.Query().Get("error"),
+			Success: r.URL.Query().Get("success"),
+		}
+
+		if name := r.URL.Query().Get("name"); name != "" {
+			var selected NotificationTemplate
+			err := callTemplatesService(r.Context(), http.MethodGet, "/"+url.PathEscape(name), nil, &selected)
+			if errors.Is(err, errTemplateRejected) {
+				data.Error = "Modello non trovato."
+			} else if err != nil {
+				slog.ErrorContext(r.Context(), "Error getting notification template", "template", name, "error", err)
+				data.Error = "Servizio di notifica non raggiungibile."
+			} else {
+				data.Selected = &selected
+			}
+		}
+
+		renderAdminTemplates(w, r, data)
+	}
+}
+
+// Save Template Handler - Send an edited template to the notification service
+func SaveTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		tmpl := NotificationTemplate{
+			Name:    strings.TrimSpace(r.FormValue("name")),
+			Subject: r.FormValue("subject"),
+			Text:    r.FormValue("text"),
+			HTML:    r.FormValue("html"),
+		}
+		if tmpl.Name == "" {
+			redirectTemplates(w, r, "", "error", "Inserisci il nome del modello.")
+			return
+		}
+
+		var saved NotificationTemplate
+		err := callTemplatesService(r.Context(), http.MethodPut, "/"+url.PathEscape(tmpl.Name), tmpl, &saved)
+		if errors.Is(err, errTemplateRejected) {
+			// show the form again with the text the admin typed
+			renderAdminTemplates(w, r, AdminTemplatesData{
+				Selected: &tmpl,
+				Error:    "Modello non valido: " + strings.TrimPrefix(err.Error(), errTemplateRejected.Error()+": "),
+			})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error saving notification template", "template", tmpl.Name, "error", err)
+			redirectTemplates(w, r, tmpl.Name, "error", "Servizio di notifica non raggiungibile.")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Notification template saved", "template", tmpl.Name)
+		redirectTemplates(w, r, tmpl.Name, "success", "Modello salvato.")
+	}
+}
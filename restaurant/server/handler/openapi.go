@@ -0,0 +1,65 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenAPI document of the JSON API, served at /api/v1/openapi.json
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Route of the JSON API, relative to the /api/v1 prefix
+type APIRoute struct {
+	Method string
+	Path   string
+}
+
+// OpenAPI Handler - Serve the OpenAPI document
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// Check that the OpenAPI document describes exactly the registered routes:
+// every route must be documented and every documented operation must exist
+func CheckOpenAPIRoutes(routes []APIRoute) error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+
+	documented := map[APIRoute]bool{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+				documented[APIRoute{Method: strings.ToUpper(method), Path: path}] = true
+			}
+		}
+	}
+
+	var problems []string
+	for _, route := range routes {
+		if !documented[route] {
+			problems = append(problems, "undocumented route "+route.Method+" "+route.Path)
+		}
+		delete(documented, route)
+	}
+	for route := range documented {
+		problems = append(problems, "documented route not registered "+route.Method+" "+route.Path)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("OpenAPI document out of date: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DayServicePeriods struct {
+	Weekday int
+	Name    string
+	Periods []database.ServicePeriod
+}
+
+type AdminOpeningHoursData struct {
+	Days            []DayServicePeriods
+	PeriodNames     []string
+	Durations       []database.DiningDuration
+	DefaultDuration int
+	Error           string
+	Success         string
+}
+
+// Helper function to redirect back to the opening hours page with a message
+func redirectOpeningHours(w http.ResponseWriter, r *http.Request, key, message string) {
+	http.Redirect(w, r, "/admin/opening-hours?"+key+"="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// Opening Hours Handler - Show the service periods of every weekday
+func AdminOpeningHoursHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		periods, err := database.GetAllServicePeriods()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting service periods", "error", err)
+			http.Error(w, "Error loading opening hours", http.StatusInternalServerError)
+			return
+		}
+
+		durations, err := database.GetDiningDurations()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting dining durations", "error", err)
+			http.Error(w, "Error loading dining durations", http.StatusInternalServerError)
+			return
+		}
+
+		// Start the week on Monday
+		data := AdminOpeningHoursData{
+			Durations:       durations,
+			DefaultDuration: database.DefaultDiningDuration,
+			Error:           r.URL.Query().Get("error"),
+			Success:         r.URL.Query().Get("success"),
+		}
+
+		seen := make(map[string]bool)
+		for _, p := range periods {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				data.PeriodNames = append(data.PeriodNames, p.Name)
+			}
+		}
+
+		for i := 1; i <= 7; i++ {
+			day := time.Weekday(i % 7)
+			dayPeriods := DayServicePeriods{Weekday: int(day), Name: database.WeekdayName(day)}
+			for _, p := range periods {
+				if p.Weekday == day {
+					dayPeriods.Periods = append(dayPeriods.Periods, p)
+				}
+			}
+			data.Days = append(data.Days, dayPeriods)
+		}
+
+		err = templates.ExecuteTemplate(w, "adminOpeningHours.html", data)
+		if err != nil {
+			http.Error(w, "Error rendering opening hours page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Save Service Period Handler - Create or update a service period
+func SaveServicePeriodHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		weekday, err := strconv.Atoi(r.FormValue("weekday"))
+		if err != nil {
+			redirectOpeningHours(w, r, "error", "Giorno non valido.")
+			return
+		}
+
+		interval, err := strconv.Atoi(r.FormValue("slot_interval"))
+		if err != nil {
+			redirectOpeningHours(w, r, "error", "Intervallo non valido.")
+			return
+		}
+
+		period := database.ServicePeriod{
+			Weekday:      time.Weekday(weekday),
+			Name:         r.FormValue("name"),
+			StartTime:    r.FormValue("start_time"),
+			LastSeating:  r.FormValue("last_seating"),
+			SlotInterval: interval,
+		}
+
+		if idStr := r.FormValue("period_id"); idStr != "" {
+			period.ID, err = strconv.Atoi(idStr)
+			if err != nil {
+				http.Error(w, "Invalid service period ID", http.StatusBadRequest)
+				return
+			}
+			err = database.UpdateServicePeriod(period)
+		} else {
+			err = database.InsertServicePeriod(period)
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error saving service period", "error", err)
+			redirectOpeningHours(w, r, "error", "Impossibile salvare la fascia oraria: "+err.Error())
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Service period saved", "period", period.Name, "weekday", period.WeekdayName())
+		redirectOpeningHours(w, r, "success", "Fascia oraria salvata.")
+	}
+}
+
+// Delete Service Period Handler - Remove a service period
+func DeleteServicePeriodHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("period_id"))
+		if err != nil {
+			http.Error(w, "Invalid service period ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.DeleteServicePeriod(id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting service period", "period_id", id, "error", err)
+			http.Error(w, "Error deleting service period", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Service period deleted", "period_id", id)
+		redirectOpeningHours(w, r, "success", "Fascia oraria eliminata.")
+	}
+}
+
+// Save Dining Duration Handler - Add a dining duration rule
+func SaveDiningDurationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		minGuests, err1 := strconv.Atoi(r.FormValue("min_guests"))
+		maxGuests, err2 := strconv.Atoi(r.FormValue("max_guests"))
+		minutes, err3 := strconv.Atoi(r.FormValue("duration_minutes"))
+		// "period:<id>" for one service period, "name:<name>" for every
+		// period with that name, empty for every service period
+		periodID := 0
+		var periodName string
+		var err4 error
+		kind, value, _ := strings.Cut(r.FormValue("applies_to"), ":")
+		switch kind {
+		case "":
+		case "period":
+			periodID, err4 = strconv.Atoi(value)
+		case "name":
+			periodName = value
+		default:
+			err4 = fmt.Errorf("unknown rule scope %q", kind)
+		}
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			redirectOpeningHours(w, r, "error", "Valori della durata non validi.")
+			return
+		}
+
+		duration := database.DiningDuration{
+			ServicePeriodID: periodID,
+			PeriodName:      periodName,
+			MinGuests:       minGuests,
+			MaxGuests:       maxGuests,
+			DurationMinutes: minutes,
+		}
+
+		if err := database.InsertDiningDuration(duration); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving dining duration", "error", err)
+			redirectOpeningHours(w, r, "error", "Impossibile salvare la durata: "+err.Error())
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Dining duration saved", "service_period_id", periodID, "service_period", periodName, "minutes", minutes, "min_guests", minGuests, "max_guests", maxGuests)
+		redirectOpeningHours(w, r, "success", "Durata salvata.")
+	}
+}
+
+// Delete Dining Duration Handler - Remove a dining duration rule
+func DeleteDiningDurationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("duration_id"))
+		if err != nil {
+			http.Error(w, "Invalid dining duration ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.DeleteDiningDuration(id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting dining duration", "duration_id", id, "error", err)
+			http.Error(w, "Error deleting dining duration", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Dining duration deleted", "duration_id", id)
+		redirectOpeningHours(w, r, "success", "Durata eliminata.")
+	}
+}
@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"progetto/logging"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Messages delivered on every run of the dispatcher
+	outboxBatchSize = 20
+	// Attempts before a message is moved to the failed ones
+	outboxMaxAttempts = 8
+	// Delay before the first retry, doubled at every failed attempt
+	outboxBaseDelay = 30 * time.Second
+	// Longest delay between two attempts
+	outboxMaxDelay = time.Hour
+)
+
+// Base address of the notification microservice
+var notificationServiceURL = "http://localhost:8081"
+
+// Override the address of the notification microservice
+func SetNotificationURL(url string) {
+	notificationServiceURL = strings.TrimRight(url, "/")
+}
+
+// Returned when the notification service refuses a message: retrying it
+// would fail again, so it is moved straight to the failed ones
+var errNotificationRejected = errors.New("notification rejected")
+
+type EmailNotification struct {
+	Channel   string                  `json:"channel"`
+	Recipient string                  `json:"recipient"`
+	Template  string                  `json:"template,omitempty"`
+	Data      map[string]any          `json:"data,omitempty"`
+	Subject   string                  `json:"subject,omitempty"`
+	Body      string                  `json:"message,omitempty"`
+	Calendar  *database.CalendarEvent `json:"calendar,omitempty"`
+}
+
+type AdminNotificationsData struct {
+	Pending []database.OutboxMessage
+	Failed  []database.OutboxMessage
+	Counts  map[string]int
+	Error   string
+	Success string
+}
+
+// Helper function to hand an outbox message to the notification service
+func sendEmailNotification(ctx context.Context, m database.OutboxMessage) error {
+	notification := EmailNotification{
+		Channel:   m.Channel,
+		Recipient: m.Recipient,
+		Template:  m.Template,
+		Data:      m.TemplateData,
+		Subject:   m.Subject,
+		Body:      m.Body,
+		Calendar:  m.Calendar,
+	}
+
+	jsonData, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notificationServiceURL+"/notification", bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.RequestID != "" {
+		req.Header.Set(logging.HeaderRequestID, m.RequestID)
+	}
+	if err := signNotificationRequest(req, jsonData); err != nil {
+		return fmt.Errorf("error signing notification: %v", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// the service explains its refusals with an error code, e.g.
+	// recipient_suppressed or invalid_recipient, shown in the failed
+	// notifications
+	status := strconv.Itoa(resp.StatusCode)
+	var refusal struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&refusal) == nil && refusal.Error != "" {
+		status += " (" + refusal.Error + ")"
+	}
+
+	// a refused signature is a configuration problem of the two services, not
+	// of the message, so the message is retried until it is fixed; so are
+	// the messages over a rate limit
+	switch {
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusUnauthorized &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: notification service returned status: %s", errNotificationRejected, status)
+	default:
+		return fmt.Errorf("notification service returned status: %s", status)
+	}
+}
+
+// Helper function to compute the delay before the next attempt, given the
+// number of attempts already made
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxDelay)
+}
+
+// Deliver the notifications that are due, scheduling a retry for the ones
+// that fail
+func dispatchNotifications() {
+	messages, err := database.GetDueNotifications(outboxBatchSize)
+	if err != nil {
+		slog.Error("Error getting due notifications", "error", err)
+		return
+	}
+
+	for _, m := range messages {
+		// the logs of the delivery carry the ID of the request that queued
+		// the message
+		ctx := logging.WithRequestID(context.Background(), m.RequestID)
+
+		err := sendEmailNotification(ctx, m)
+		if err == nil {
+			if err := database.MarkNotificationSent(m.ID); err != nil {
+				slog.ErrorContext(ctx, "Error marking notification as sent", "notification_id", m.ID, "error", err)
+			}
+			slog.InfoContext(ctx, "Notification sent", "notification_id", m.ID, "recipient", m.Recipient)
+			continue
+		}
+
+		attempts := m.Attempts + 1
+		giveUp := attempts >= outboxMaxAttempts || errors.Is(err, errNotificationRejected)
+		nextAttemptAt := time.Now().Add(outboxRetryDelay(attempts))
+		if err := database.MarkNotificationAttemptFailed(m.ID, err.Error(), nextAttemptAt, giveUp); err != nil {
+			slog.ErrorContext(ctx, "Error recording failed notification", "notification_id", m.ID, "error", err)
+		}
+
+		if giveUp {
+			slog.ErrorContext(ctx, "Notification failed, giving up", "notification_id", m.ID, "recipient", m.Recipient, "attempts", attempts, "error", err)
+		} else {
+			slog.WarnContext(ctx, "Notification failed, retrying",
+				"notification_id", m.ID, "recipient", m.Recipient, "attempts", attempts, "retry_at", nextAttemptAt, "error", err)
+		}
+	}
+}
+
+// Periodically deliver the queued notifications until the context is canceled.
+// wg is done when the last run has finished.
+func StartNotificationDispatcher(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			dispatchNotifications()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Helper function to redirect back to the notifications page with a message
+func redirectNotifications(w http.ResponseWriter, r *http.Request, key, message string) {
+	http.Redirect(w, r, "/admin/notifications?"+key+"="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// Admin Notifications Handler - List the pending and failed notifications
+func AdminNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		data := AdminNotificationsData{
+			Error:   r.URL.Query().Get("error"),
+			Success: r.URL.Query().Get("success"),
+		}
+
+		var err error
+		data.Pending, err = database.GetOutboxMessages(database.OutboxPending, 100)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting pending notifications", "error", err)
+			http.Error(w, "Error loading notifications", http.StatusInternalServerError)
+			return
+		}
+
+		data.Failed, err = database.GetOutboxMessages(database.OutboxFailed, 100)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting failed notifications", "error", err)
+			http.Error(w, "Error loading notifications", http.StatusInternalServerError)
+			return
+		}
+
+		data.Counts, err = database.GetOutboxCounts()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting notifications", "error", err)
+			http.Error(w, "Error loading notifications", http.StatusInternalServerError)
+			return
+		}
+
+		err = templates.ExecuteTemplate(w, "adminNotifications.html", data)
+		if err != nil {
+			http.Error(w, "Error rendering notifications page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Resend Notification Handler - Queue a notification for immediate delivery
+func ResendNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("notification_id"))
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		err = database.ResendNotification(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			redirectNotifications(w, r, "error", "Notifica non trovata o già inviata.")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error resending notification", "notification_id", id, "error", err)
+			http.Error(w, "Error resending notification", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Notification queued again", "notification_id", id)
+		redirectNotifications(w, r, "success", "Notifica rimessa in coda.")
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"progetto/logging"
+	"progetto/restaurant/server/database"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long before a confirmed reservation the guest is reminded of it
+var reminderLeadTimes = []time.Duration{24 * time.Hour, 2 * time.Hour}
+
+// Public address of the site, used for the links in the notifications
+var publicURL = "http://localhost:8080"
+
+// Override the default reminder lead times
+func SetReminderLeadTimes(leads []time.Duration) {
+	reminderLeadTimes = leads
+}
+
+// Override the public address of the site
+func SetPublicURL(url string) {
+	publicURL = strings.TrimRight(url, "/")
+}
+
+// Helper function to build the reminder of a reservation. It carries no
+// calendar event: the guest already got one with the confirmation. Besides
+// the page to change the booking, it carries the same signed links to confirm
+// the attendance or cancel as the confirmation (see addReservationLinks).
+func reminderNotice(ctx context.Context, reservation *database.Reservation) database.OutboxMessage {
+	m := guestNotice(ctx, reservation, "reminder", false)
+	m.Calendar = nil
+	m.TemplateData["manage_url"] = publicURL + "/my-bookings"
+	addReservationLinks(&m, reservation)
+	return m
+}
+
+// Helper function to pick the reminder due for a reservation starting in
+// untilStart: the shortest lead time that has already been reached. Longer
+// ones are skipped when it is too late for them, e.g. for a reservation
+// confirmed one hour before the meal only the last reminder is sent.
+func dueReminderLead(untilStart time.Duration) (time.Duration, bool) {
+	leads := append([]time.Duration(nil), reminderLeadTimes...)
+	sort.Slice(leads, func(i, j int) bool { return leads[i] < leads[j] })
+
+	for _, lead := range leads {
+		if untilStart <= lead {
+			return lead, true
+		}
+	}
+	return 0, false
+}
+
+// Queue the reminders that are due
+func sendDueReminders(ctx context.Context, now time.Time) {
+	if len(reminderLeadTimes) == 0 {
+		return
+	}
+
+	longest := reminderLeadTimes[0]
+	for _, lead := range reminderLeadTimes {
+		longest = max(longest, lead)
+	}
+
+	reservations, err := database.GetConfirmedReservationsBetween(now.Format("2006-01-02"), now.Add(longest).Format("2006-01-02"))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting upcoming reservations", "error", err)
+		return
+	}
+
+	for i := range reservations {
+		reservation := &reservations[i]
+		start, err := reservationStart(reservation)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error parsing start of reservation", "reservation_id", reservation.ID, "error", err)
+			continue
+		}
+
+		untilStart := start.Sub(now)
+		if untilStart <= 0 {
+			continue
+		}
+		lead, ok := dueReminderLead(untilStart)
+		if !ok {
+			continue
+		}
+
+		leadMinutes := int(lead.Minutes())
+		sent, err := database.ReminderSent(reservation.ID, leadMinutes)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error checking reminder", "reservation_id", reservation.ID, "error", err)
+			continue
+		}
+		if sent {
+			continue
+		}
+
+		queued, err := database.QueueReminder(reservation, leadMinutes, reminderNotice(ctx, reservation))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error queuing reminder", "reservation_id", reservation.ID, "error", err)
+			continue
+		}
+		if queued {
+			slog.InfoContext(ctx, "Reminder queued", "reservation_id", reservation.ID, "lead", lead.String())
+		}
+	}
+}
+
+// Periodically queue the due reminders until the context is canceled.
+// wg is done when the last run has finished.
+func StartReminderScheduler(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// the reminders queued by a run share a request ID
+			sendDueReminders(logging.WithRequestID(ctx, logging.NewRequestID()), time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
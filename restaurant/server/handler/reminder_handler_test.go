@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"progetto/restaurant/server/database"
+	"testing"
+	"time"
+)
+
+// The reminder lets the guest confirm or cancel with one click
+func TestReminderNoticeLinks(t *testing.T) {
+	database.InitDatabase(filepath.Join(t.TempDir(), "restaurant.db"))
+	t.Cleanup(database.CloseDatabase)
+	SetLinkSecret("0123456789abcdef0123456789abcdef")
+
+	start := time.Now().Add(3 * time.Hour)
+	reservation := &database.Reservation{
+		ID:              42,
+		Email:           "mario@example.com",
+		ReservationDate: start.Format("2006-01-02"),
+		ReservationTime: start.Format("15:04"),
+		Guests:          2,
+		Status:          "confirmed",
+		DurationMinutes: 120,
+	}
+
+	m := reminderNotice(context.Background(), reservation)
+	for key, action := range map[string]string{"confirm_url": linkActionConfirm, "cancel_url": linkActionCancel} {
+		link, _ := m.TemplateData[key].(string)
+		u, err := url.Parse(link)
+		if err != nil || link == "" {
+			t.Fatalf("%s = %q, want a link", key, link)
+		}
+		id, gotAction, _, err := verifyReservationLink(u.Query().Get("token"), time.Now())
+		if err != nil || id != reservation.ID || gotAction != action {
+			t.Errorf("%s verifies as reservation %d, action %q, error %v", key, id, gotAction, err)
+		}
+	}
+	if m.TemplateData["manage_url"] == nil {
+		t.Error("manage_url is missing")
+	}
+}
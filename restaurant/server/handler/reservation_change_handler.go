@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"progetto/logging"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Address notified when guests change their reservations
+var restaurantEmail = "crisbi.restaurant@gmail.com"
+
+// Location of the calendar events sent to the guests
+var restaurantAddress = "Crisbi's"
+
+// Minimum notice required to cancel or modify a reservation
+var cancellationCutoff = 2 * time.Hour
+
+type MyBooking struct {
+	database.Reservation
+	CanChange bool
+}
+
+type MyBookingsData struct {
+	Bookings []MyBooking
+	Error    string
+	Success  string
+}
+
+// Override the default cancellation cutoff
+func SetCancellationCutoff(d time.Duration) {
+	cancellationCutoff = d
+}
+
+// Override the address notified of the changes made by the guests
+func SetRestaurantEmail(email string) {
+	restaurantEmail = email
+}
+
+// Override the location of the calendar events
+func SetRestaurantAddress(address string) {
+	restaurantAddress = address
+}
+
+// Helper function to format the cutoff for the guest, e.g. "2 ore" or "30 minuti"
+func formatCutoff(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if d == time.Hour {
+			return "1 ora"
+		}
+		return fmt.Sprintf("%d ore", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d minuti", int(d.Minutes()))
+}
+
+// Helper function to get the start of a reservation in local time
+func reservationStart(reservation *database.Reservation) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", reservation.ReservationDate+" "+reservation.ReservationTime, time.Local)
+}
+
+// Helper function to check whether the guest can still cancel or modify a
+// reservation. Returns the reason when they cannot, or nil.
+func canChangeReservation(reservation *database.Reservation) *guestMessage {
+	if reservation.Status != "pending" && reservation.Status != "confirmed" {
+		return &guestMessage{"La prenotazione non è più attiva.", "The reservation is no longer active."}
+	}
+
+	start, err := reservationStart(reservation)
+	if err != nil {
+		return &guestMessage{"Data della prenotazione non valida.", "The reservation has an invalid date."}
+	}
+
+	if time.Until(start) < cancellationCutoff {
+		return &guestMessage{
+			fmt.Sprintf("Le prenotazioni possono essere modificate o annullate fino a %s prima dell'orario.", formatCutoff(cancellationCutoff)),
+			fmt.Sprintf("Reservations can be modified or canceled up to %d minutes before their time.", int(cancellationCutoff.Minutes())),
+		}
+	}
+	return nil
+}
+
+// Helper function to load the reservation in the URL, checking that it belongs
+// to the logged in user. Reservations of other users are reported as not found.
+func getOwnedReservation(w http.ResponseWriter, r *http.Request) (*database.Reservation, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	reservation, err := database.GetReservation(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && reservation.Email != getSessionUser(r).Email) {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", id, "error", err)
+		http.Error(w, "Error retrieving reservation", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// Helper function to build the data of the reservation templates of the
+// notification service
+func reservationTemplateData(reservation *database.Reservation) map[string]any {
+	return map[string]any{
+		"reservation_id":   reservation.ID,
+		"name":             reservation.Name,
+		"email":            reservation.Email,
+		"date":             reservation.ReservationDate,
+		"time":             reservation.ReservationTime,
+		"guests":           reservation.Guests,
+		"tables":           reservation.TableLabel(),
+		"duration_minutes": reservation.DurationMinutes,
+	}
+}
+
+// Helper function to build the calendar event of a reservation. Every message
+// about the same reservation uses the same UID, so the guest's calendar
+// updates or removes the event it already has.
+func reservationCalendarEvent(reservation *database.Reservation, cancelled bool) *database.CalendarEvent {
+	start, err := reservationStart(reservation)
+	if err != nil {
+		slog.Error("Error parsing start of reservation", "reservation_id", reservation.ID, "error", err)
+		return nil
+	}
+
+	return &database.CalendarEvent{
+		UID:             fmt.Sprintf("reservation-%d@crisbis", reservation.ID),
+		Start:           start,
+		DurationMinutes: reservation.DurationMinutes,
+		Summary:         "Prenotazione da Crisbi's",
+		Description:     fmt.Sprintf("Prenotazione #%d per %d persone, tavolo %s", reservation.ID, reservation.Guests, reservation.TableLabel()),
+		Location:        restaurantAddress,
+		Cancelled:       cancelled,
+	}
+}
+
+// Helper function to build a message telling the restaurant that a guest
+// changed a reservation
+func restaurantNotice(ctx context.Context, reservationID int, template string, data map[string]any) database.OutboxMessage {
+	return database.OutboxMessage{
+		ReservationID: reservationID,
+		Recipient:     restaurantEmail,
+		Template:      template,
+		TemplateData:  data,
+		RequestID:     logging.RequestID(ctx),
+	}
+}
+
+// Helper function to build the message telling the restaurant that a guest
+// canceled a reservation
+func cancellationNotice(ctx context.Context, reservation *database.Reservation) database.OutboxMessage {
+	return restaurantNotice(ctx, reservation.ID, "reservation_cancelled", reservationTemplateData(reservation))
+}
+
+// Helper function to build the message confirming to the guest that their
+// reservation was canceled
+func guestCancellationNotice(ctx context.Context, reservation *database.Reservation) database.OutboxMessage {
+	return guestNotice(ctx, reservation, "reservation_cancellation_confirmed", true)
+}
+
+// Helper function to build the message telling the restaurant that a guest
+// moved a reservation; changed holds the new date, time, guests and tables
+func modificationNotice(ctx context.Context, reservation *database.Reservation, changed database.Reservation) database.OutboxMessage {
+	data := reservationTemplateData(reservation)
+	data["before"] = reservationTemplateData(reservation)
+	data["after"] = reservationTemplateData(&changed)
+	return restaurantNotice(ctx, reservation.ID, "reservation_modified", data)
+}
+
+// Helper function to build the notifications of a change for ModifyReservation
+func modificationNotices(ctx context.Context, reservation *database.Reservation, date, timeSlot string, guests int) func([]int) []database.OutboxMessage {
+	return func(tables []int) []database.OutboxMessage {
+		return []database.OutboxMessage{modificationNotice(ctx, reservation, database.Reservation{
+			ReservationDate: date,
+			ReservationTime: timeSlot,
+			Guests:          guests,
+			Tables:          tables,
+		})}
+	}
+}
+
+// Cancel My Booking Handler - Let the guest cancel one of their reservations
+func CancelMyBookingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		reservation, ok := getOwnedReservation(w, r)
+		if !ok {
+			return
+		}
+
+		if canChangeReservation(reservation) != nil {
+			http.Redirect(w, r, "/my-bookings?error=locked", http.StatusSeeOther)
+			return
+		}
+
+		err := database.CancelReservation(reservation.ID, database.SourceGuest, cancellationNotice(r.Context(), reservation), guestCancellationNotice(r.Context(), reservation))
+		if errors.Is(err, database.ErrReservationStatusChanged) {
+			http.Redirect(w, r, "/my-bookings?error=locked", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error canceling reservation", "reservation_id", reservation.ID, "error", err)
+			http.Error(w, "Error canceling reservation", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Reservation canceled by the guest", "reservation_id", reservation.ID)
+		http.Redirect(w, r, "/my-bookings?success=canceled", http.StatusSeeOther)
+	}
+}
+
+// Edit My Booking Handler - Let the guest move one of their reservations.
+// GET shows the date and guests form, a POST without time shows the available
+// slots and a POST with time applies the change.
+func EditMyBookingHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := getOwnedReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if canChangeReservation(reservation) != nil {
+		http.Redirect(w, r, "/my-bookings?error=locked", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		renderBookingPage(w, BookingPageData{
+			ReservationID: reservation.ID,
+			Date:          reservation.ReservationDate,
+			Guests:        reservation.Guests,
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	// Parse form data
+	if err := r.ParseForm(); err != nil {
+		slog.ErrorContext(r.Context(), "Error parsing form", "error", err)
+		renderBookingPage(w, BookingPageData{ReservationID: reservation.ID, Error: "Errore nel form. Riprova."})
+		return
+	}
+
+	date := r.FormValue("date")
+	timeSlot := r.FormValue("time")
+	guestsStr := r.FormValue("guests")
+
+	if date == "" || guestsStr == "" {
+		renderBookingPage(w, BookingPageData{ReservationID: reservation.ID, Error: "Tutti i campi sono obbligatori."})
+		return
+	}
+
+	// Parse guests
+	maxGuests, ok := maxPartySize(w, r)
+	if !ok {
+		return
+	}
+	guests, err := strconv.Atoi(guestsStr)
+	if err != nil || guests < 1 || guests > maxGuests {
+		renderBookingPage(w, BookingPageData{
+			ReservationID: reservation.ID,
+			Error:         fmt.Sprintf("Numero di ospiti non valido (1-%d).", maxGuests),
+		})
+		return
+	}
+
+	// Step 2: show the slots the reservation can be moved to
+	if timeSlot == "" {
+		data := availableSlotsPage(date, guests, reservation.ID)
+		data.ReservationID = reservation.ID
+		renderBookingPage(w, data)
+		return
+	}
+
+	// Final step: validate and apply the change
+	if message := validateBookingSlot(date, timeSlot, guests); message != nil {
+		renderBookingPage(w, BookingPageData{ReservationID: reservation.ID, Error: message.Italian, Date: date, Guests: guests})
+		return
+	}
+
+	tables, err := database.ModifyReservation(reservation.ID, date, timeSlot, guests, database.SourceGuest,
+		modificationNotices(r.Context(), reservation, date, timeSlot, guests))
+	if errors.Is(err, database.ErrReservationStatusChanged) {
+		http.Redirect(w, r, "/my-bookings?error=locked", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, database.ErrNoAvailableTable) {
+		data := availableSlotsPage(date, guests, reservation.ID)
+		data.ReservationID = reservation.ID
+		data.Error = "Questo orario non è più disponibile. Seleziona un altro orario."
+		renderBookingPage(w, data)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error modifying reservation", "reservation_id", reservation.ID, "error", err)
+		renderBookingPage(w, BookingPageData{
+			ReservationID: reservation.ID,
+			Error:         "Errore nella modifica della prenotazione. Riprova.",
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Reservation modified by the guest", "reservation_id", reservation.ID, "date", date, "time", timeSlot, "guests", guests, "tables", tables)
+	http.Redirect(w, r, "/my-bookings?success=modified", http.StatusSeeOther)
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"progetto/restaurant/server/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions a guest can take from the links in the emails, without logging in
+const (
+	linkActionConfirm = "confirm"
+	linkActionCancel  = "cancel"
+)
+
+var (
+	// Returned when a link was not signed by us or was tampered with
+	errInvalidLink = errors.New("invalid reservation link")
+	// Returned when the reservation the link is about has already started
+	errExpiredLink = errors.New("expired reservation link")
+)
+
+// Key signing the links, from LINK_SECRET so that the links already sent
+// keep working across restarts
+var linkSecret []byte
+
+type ReservationLinkData struct {
+	Token       string
+	Action      string
+	Reservation *database.Reservation
+	// The action of the link can still be taken
+	CanAct  bool
+	Error   string
+	Success string
+}
+
+// Set the key signing the links
+func SetLinkSecret(secret string) {
+	linkSecret = []byte(secret)
+}
+
+// Helper function to compute the signature of the payload of a link
+func linkSignature(payload string) string {
+	mac := hmac.New(sha256.New, linkSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Helper function to build the token of a link: the reservation, the action
+// and the expiry, followed by their signature
+func signReservationLink(reservationID int, action string, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%s.%d", reservationID, action, expires.Unix())
+	return payload + "." + linkSignature(payload)
+}
+
+// Helper function to check the signature and the expiry of a token
+func verifyReservationLink(token string, now time.Time) (int, string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return 0, "", time.Time{}, errInvalidLink
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(linkSignature(payload))) {
+		return 0, "", time.Time{}, errInvalidLink
+	}
+
+	reservationID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", time.Time{}, errInvalidLink
+	}
+	action := parts[1]
+	if action != linkActionConfirm && action != linkActionCancel {
+		return 0, "", time.Time{}, errInvalidLink
+	}
+	unix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, "", time.Time{}, errInvalidLink
+	}
+
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return 0, "", time.Time{}, errExpiredLink
+	}
+	return reservationID, action, expires, nil
+}
+
+// Helper function to build the link taking an action on a reservation. The
+// link expires when the reservation starts, and a change of date or time
+// makes it invalid since the expiry no longer matches the reservation.
+func reservationLinkURL(reservation *database.Reservation, action string) string {
+	start, err := reservationStart(reservation)
+	if err != nil {
+		slog.Error("Error parsing start of reservation", "reservation_id", reservation.ID, "error", err)
+		return publicURL + "/my-bookings"
+	}
+	token := signReservationLink(reservation.ID, action, start)
+	return publicURL + "/reservation-link?" + url.Values{"token": {token}}.Encode()
+}
+
+// Helper function to add the confirm and cancel links to the template data
+// of a message for the guest
+func addReservationLinks(m *database.OutboxMessage, reservation *database.Reservation) {
+	m.TemplateData["confirm_url"] = reservationLinkURL(reservation, linkActionConfirm)
+	m.TemplateData["cancel_url"] = reservationLinkURL(reservation, linkActionCancel)
+}
+
+// Helper function to check whether the action of a link can be taken,
+// returning the explanation for the guest when it cannot
+func canTakeLinkAction(reservation *database.Reservation, action string) (bool, string) {
+	if action == linkActionCancel {
+		if message := canChangeReservation(reservation); message != nil {
+			return false, message.Italian
+		}
+		return true, ""
+	}
+
+	switch {
+	case reservation.Status == "pending":
+		return false, "La prenotazione non è ancora stata confermata dal ristorante."
+	case reservation.Status != "confirmed":
+		return false, "La prenotazione non è più attiva."
+	case reservation.AttendanceConfirmed:
+		return false, "Hai già confermato la tua presenza. Ti aspettiamo!"
+	}
+	return true, ""
+}
+
+// Helper function to render the page of a link
+func renderReservationLink(w http.ResponseWriter, status int, data ReservationLinkData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "reservationLink.html", data); err != nil {
+		slog.Error("Error rendering reservation link page", "error", err)
+	}
+}
+
+// Reservation Link Handler - Let a guest confirm their attendance or cancel a
+// reservation from the signed link in an email. GET only shows the
+// reservation, so mail scanners opening the link change nothing; the action
+// is taken by the POST of the button on the page.
+func ReservationLinkHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	reservationID, action, expires, err := verifyReservationLink(token, time.Now())
+	if errors.Is(err, errExpiredLink) {
+		renderReservationLink(w, http.StatusGone, ReservationLinkData{Error: "Il link è scaduto."})
+		return
+	}
+	if err != nil {
+		renderReservationLink(w, http.StatusBadRequest, ReservationLinkData{Error: "Link non valido."})
+		return
+	}
+
+	reservation, err := database.GetReservation(reservationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		renderReservationLink(w, http.StatusNotFound, ReservationLinkData{Error: "Link non valido."})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting reservation", "reservation_id", reservationID, "error", err)
+		http.Error(w, "Error retrieving reservation", http.StatusInternalServerError)
+		return
+	}
+
+	data := ReservationLinkData{Token: token, Action: action, Reservation: reservation}
+
+	if start, err := reservationStart(reservation); err != nil || !start.Equal(expires) {
+		data.Error = "La prenotazione è stata modificata: usa il link dell'ultima email che hai ricevuto."
+		renderReservationLink(w, http.StatusConflict, data)
+		return
+	}
+
+	canAct, message := canTakeLinkAction(reservation, action)
+	if r.Method != http.MethodPost || !canAct {
+		data.CanAct = canAct
+		data.Error = message
+		renderReservationLink(w, http.StatusOK, data)
+		return
+	}
+
+	switch action {
+	case linkActionCancel:
+		err = database.CancelReservation(reservation.ID, database.SourceEmailLink, cancellationNotice(r.Context(), reservation), guestCancellationNotice(r.Context(), reservation))
+		if errors.Is(err, database.ErrReservationStatusChanged) {
+			// canceled meanwhile, e.g. by a second click on the button
+			data.Error = "La prenotazione non è più attiva."
+			renderReservationLink(w, http.StatusConflict, data)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error canceling reservation", "reservation_id", reservation.ID, "error", err)
+			http.Error(w, "Error canceling reservation", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Reservation canceled by the guest from the email link", "reservation_id", reservation.ID)
+		reservation.Status = "canceled"
+		data.Success = "La prenotazione è stata annullata."
+
+	case linkActionConfirm:
+		if _, err := database.ConfirmAttendance(reservation.ID, database.SourceEmailLink); err != nil {
+			slog.ErrorContext(r.Context(), "Error confirming attendance", "reservation_id", reservation.ID, "error", err)
+			http.Error(w, "Error confirming attendance", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Attendance confirmed from the email link", "reservation_id", reservation.ID)
+		reservation.AttendanceConfirmed = true
+		data.Success = "Grazie per la conferma. Ti aspettiamo!"
+	}
+
+	renderReservationLink(w, http.StatusOK, data)
+}
@@ -1,18 +1,30 @@
 package handler
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
+	"errors"
 	"html/template"
+	"log/slog"
 	"net/http"
 	"progetto/restaurant/server/database"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 var templates *template.Template
 
-func init() {
-	templates = template.Must(template.ParseGlob("server/templates/*.html"))
+// Explanation of why a request of a guest is refused, shown in Italian on the
+// web pages and returned in English by the API
+type guestMessage struct {
+	Italian string
+	English string
+}
+
+// Set the templates of the pages, parsed at startup
+func SetTemplates(t *template.Template) {
+	templates = t
 }
 
 // Generate a session token
@@ -24,70 +36,104 @@ func generateSessionToken() (string, error) {
 	return token.String(), nil
 }
 
-func ValidateSession(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_token")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+// The server runs behind a reverse proxy whose X-Forwarded-Proto header can
+// be trusted
+var trustProxy bool
+
+// Trust the X-Forwarded-Proto header of the reverse proxy in front of the
+// server
+func SetTrustProxy(trust bool) {
+	trustProxy = trust
+}
+
+// Check whether the request reached us over HTTPS, directly or through the
+// trusted proxy. Without a trusted proxy the header is ignored, since any
+// client can send it.
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (trustProxy && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// Set the session cookie. Persistent ("remember me") cookies carry an explicit
+// expiry, the others live until the browser is closed.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, persistent bool, expiresAt time.Time) {
+	cookie := &http.Cookie{
+		Name:     "session_token",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
 	}
-	_, err = database.ValidateSessionToken(cookie.Value)
-	if err != nil {
-		if err.Error() == "session expired" {
-			http.Redirect(w, r, "/", http.StatusSeeOther)
-		}
+	if persistent {
+		cookie.Expires = expiresAt
+		cookie.MaxAge = int(time.Until(expiresAt).Seconds())
 	}
+	http.SetCookie(w, cookie)
+}
+
+// Remove the session cookie from the browser
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
 }
 
-// Middleware to check if user is admin
-func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		username, err := getUsernameFromSession(r)
+type sessionUserKey struct{}
+
+// Middleware resolving the session cookie once per request and storing the
+// user owning it in the context. Requests without a valid session are sent to
+// the login page and never reach the handler.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session_token")
 		if err != nil {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 
-		role, err := database.GetUserRole(username)
-		if err != nil || role != "admin" {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
-			return
-		}
-
-		next(w, r)
-	}
-}
-
-// Middleware to check if user is client
-func RequireClient(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		username, err := getUsernameFromSession(r)
-		if err != nil {
+		user, err := database.GetSessionUser(cookie.Value)
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, database.ErrSessionExpired) {
+			clearSessionCookie(w, r)
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-
-		role, err := database.GetUserRole(username)
-		if err != nil || role != "client" {
-			http.Error(w, "Forbidden: Client access required", http.StatusForbidden)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error validating session", "error", err)
+			http.Error(w, "Error validating session", http.StatusInternalServerError)
 			return
 		}
 
-		next(w, r)
-	}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionUserKey{}, user)))
+	})
 }
 
-func getUsernameFromSession(r *http.Request) (string, error) {
-	cookie, err := r.Cookie("session_token")
-	if err != nil {
-		return "", err
+// Middleware letting through only the users with the given role, to be
+// chained after Authenticate
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getSessionUser(r)
+			if user == nil {
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			if user.Role != role {
+				http.Error(w, "Forbidden: "+role+" access required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	username, err := database.ValidateSessionToken(cookie.Value)
-	if err != nil {
-		if err.Error() == "session expired" {
-			return "", fmt.Errorf("session expired")
-		}
-		return "", err
-	}
-	return username, nil
+// Get the user authenticated by the session middleware
+func getSessionUser(r *http.Request) *database.SessionUser {
+	user, _ := r.Context().Value(sessionUserKey{}).(*database.SessionUser)
+	return user
 }
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of a search for free tables
+const (
+	TablesFound   = "found"
+	TablesNoTable = "no_table"
+	TablesError   = "error"
+)
+
+// Status of a reservation before it is created
+const StatusNew = "new"
+
+var (
+	// Latency of the HTTP requests, by route template rather than by path so
+	// that reservation IDs do not multiply the series
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Reservations moving from one status to another
+	reservationTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "restaurant_reservation_transitions_total",
+		Help: "Reservations changing status, by previous and new status.",
+	}, []string{"from", "to"})
+
+	// Searches for free tables made to book or move a reservation
+	tableSearches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "restaurant_table_searches_total",
+		Help: "Searches for free tables by operation and outcome (found, no_table, error).",
+	}, []string{"operation", "outcome"})
+)
+
+// Count a reservation changing status. Changes that keep the status, like
+// moving a pending reservation, are not transitions.
+func ReservationTransition(from, to string) {
+	if from == to {
+		return
+	}
+	reservationTransitions.WithLabelValues(from, to).Inc()
+}
+
+// Count the outcome of a search for free tables
+func TableSearch(operation, outcome string) {
+	tableSearches.WithLabelValues(operation, outcome).Inc()
+}
+
+// Handler exposing the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+type contextKey string
+
+const routeKey contextKey = "route"
+
+// Route a request is recorded under, updated by the nested routers
+type route struct {
+	name string
+}
+
+// Helper function to get the template of the route matched by a router
+func routeTemplate(r *http.Request) string {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return ""
+	}
+	if template, err := current.GetPathTemplate(); err == nil {
+		return template
+	}
+	return ""
+}
+
+// Response writer remembering the status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware recording the latency of every request matched by the router
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matched := &route{name: routeTemplate(r)}
+		ctx := context.WithValue(r.Context(), routeKey, matched)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		httpDuration.WithLabelValues(r.Method, matched.name, strconv.Itoa(recorder.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// Middleware of a router mounted under a route of another one, recording its
+// requests under its own route instead of the prefix it is mounted on
+func NestedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matched, ok := r.Context().Value(routeKey).(*route); ok {
+			if template := routeTemplate(r); template != "" {
+				matched.name = template
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
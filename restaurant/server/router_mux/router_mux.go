@@ -3,7 +3,11 @@ package router_mux
 import (
 	"html/template"
 	"net/http"
+	"progetto/logging"
 	"progetto/restaurant/server/handler"
+	"progetto/restaurant/server/metrics"
+	"regexp"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -15,32 +19,142 @@ var Templates *template.Template
 func InitRouter() *mux.Router {
 	r := mux.NewRouter()
 
+	// every request gets an ID, logged with everything it causes
+	r.Use(logging.Middleware)
+	// and its latency is recorded by route
+	r.Use(metrics.Middleware)
+
+	// JSON API
+	r.PathPrefix("/api/v1/").Handler(initAPIRouter())
+
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./server/static"))))
 
 	// Public routes
 	r.HandleFunc("/", handler.LoginHandler).Methods("GET", "POST")
 	r.HandleFunc("/register", handler.RegisterHandler).Methods("GET", "POST")
 	r.HandleFunc("/logout", handler.LogoutHandler).Methods("GET")
+	r.HandleFunc("/reservation-link", handler.ReservationLinkHandler).Methods("GET", "POST")
 
-	// Client routes
-	r.HandleFunc("/home", handler.RequireClient(handler.HomePageHandler)).Methods("GET", "POST")
-	r.HandleFunc("/account", handler.RequireClient(handler.InformationHandler)).Methods("GET", "POST")
-	r.HandleFunc("/delete", handler.RequireClient(handler.DeleteAccountHandler)).Methods("POST")
+	// Liveness and readiness probes
+	r.HandleFunc("/healthz", handler.HealthHandler).Methods("GET")
+	r.HandleFunc("/readyz", handler.ReadinessHandler).Methods("GET")
+
+	// Prometheus metrics
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Client routes. Authenticate resolves the session once, stores its user in
+	// the context and stops the requests without one; RequireRole stops the
+	// users of the other role.
+	client := r.NewRoute().Subrouter()
+	client.Use(handler.Authenticate, handler.RequireRole("client"))
+	client.HandleFunc("/home", handler.HomePageHandler).Methods("GET", "POST")
+	client.HandleFunc("/account", handler.InformationHandler).Methods("GET", "POST")
+	client.HandleFunc("/delete", handler.DeleteAccountHandler).Methods("POST")
 
 	// Booking routes (Option B - multi-step)
-	r.HandleFunc("/booking", handler.RequireClient(handler.BookingPageHandler)).Methods("GET")
-	r.HandleFunc("/booking/step1", handler.RequireClient(handler.BookingStep1Handler)).Methods("POST")
-	r.HandleFunc("/booking/create", handler.RequireClient(handler.CreateBookingHandler)).Methods("POST")
-	r.HandleFunc("/my-bookings", handler.RequireClient(handler.MyBookingsHandler)).Methods("GET")
+	client.HandleFunc("/booking", handler.BookingPageHandler).Methods("GET")
+	client.HandleFunc("/booking/step1", handler.BookingStep1Handler).Methods("POST")
+	client.HandleFunc("/booking/create", handler.CreateBookingHandler).Methods("POST")
+	client.HandleFunc("/my-bookings", handler.MyBookingsHandler).Methods("GET")
+	client.HandleFunc("/my-bookings/{id:[0-9]+}/cancel", handler.CancelMyBookingHandler).Methods("POST")
+	client.HandleFunc("/my-bookings/{id:[0-9]+}/edit", handler.EditMyBookingHandler).Methods("GET", "POST")
 
 	// Admin routes
-	r.HandleFunc("/admin/dashboard", handler.RequireAdmin(handler.AdminDashboardHandler)).Methods("GET")
-	r.HandleFunc("/admin/confirm", handler.RequireAdmin(handler.ConfirmReservationHandler)).Methods("POST")
-	r.HandleFunc("/admin/reject", handler.RequireAdmin(handler.RejectReservationHandler)).Methods("POST")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(handler.Authenticate, handler.RequireRole("admin"))
+	admin.HandleFunc("/dashboard", handler.AdminDashboardHandler).Methods("GET")
+	admin.HandleFunc("/confirm", handler.ConfirmReservationHandler).Methods("POST")
+	admin.HandleFunc("/reject", handler.RejectReservationHandler).Methods("POST")
+	admin.HandleFunc("/opening-hours", handler.AdminOpeningHoursHandler).Methods("GET")
+	admin.HandleFunc("/opening-hours/save", handler.SaveServicePeriodHandler).Methods("POST")
+	admin.HandleFunc("/opening-hours/delete", handler.DeleteServicePeriodHandler).Methods("POST")
+	admin.HandleFunc("/durations/save", handler.SaveDiningDurationHandler).Methods("POST")
+	admin.HandleFunc("/durations/delete", handler.DeleteDiningDurationHandler).Methods("POST")
+	admin.HandleFunc("/closures", handler.AdminClosuresHandler).Methods("GET")
+	admin.HandleFunc("/closures/save", handler.SaveClosureHandler).Methods("POST")
+	admin.HandleFunc("/closures/delete", handler.DeleteClosureHandler).Methods("POST")
+	admin.HandleFunc("/sessions", handler.AdminSessionsHandler).Methods("GET")
+	admin.HandleFunc("/sessions/revoke", handler.RevokeSessionHandler).Methods("POST")
+	admin.HandleFunc("/sessions/revoke-user", handler.RevokeUserSessionsHandler).Methods("POST")
+	admin.HandleFunc("/notifications", handler.AdminNotificationsHandler).Methods("GET")
+	admin.HandleFunc("/notifications/resend", handler.ResendNotificationHandler).Methods("POST")
+	admin.HandleFunc("/templates", handler.AdminTemplatesHandler).Methods("GET")
+	admin.HandleFunc("/templates/save", handler.SaveTemplateHandler).Methods("POST")
 
 	return r
 }
 
+// Initialize the router of the JSON API and check its routes against the
+// OpenAPI document. It is a separate router rather than a subrouter because
+// subrouters answer 404 instead of 405 on a method mismatch.
+func initAPIRouter() *mux.Router {
+	api := mux.NewRouter()
+	api.NotFoundHandler = http.HandlerFunc(handler.APINotFoundHandler)
+	api.MethodNotAllowedHandler = http.HandlerFunc(handler.APIMethodNotAllowedHandler)
+	api.Use(metrics.NestedMiddleware)
+
+	// Public routes
+	api.HandleFunc("/api/v1/openapi.json", handler.OpenAPIHandler).Methods("GET")
+	api.HandleFunc("/api/v1/auth/register", handler.APIRegisterHandler).Methods("POST")
+	api.HandleFunc("/api/v1/auth/login", handler.APILoginHandler).Methods("POST")
+
+	// Authenticated routes
+	api.HandleFunc("/api/v1/auth/logout", handler.RequireAPIUser(handler.APILogoutHandler)).Methods("POST")
+	api.HandleFunc("/api/v1/account", handler.RequireAPIUser(handler.APIGetAccountHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/account", handler.RequireAPIUser(handler.APIUpdateAccountHandler)).Methods("PUT")
+	api.HandleFunc("/api/v1/account", handler.RequireAPIUser(handler.APIDeleteAccountHandler)).Methods("DELETE")
+	api.HandleFunc("/api/v1/account/api-keys", handler.RequireAPIUser(handler.APIListKeysHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/account/api-keys", handler.RequireAPIUser(handler.APICreateKeyHandler)).Methods("POST")
+	api.HandleFunc("/api/v1/account/api-keys/{id:[0-9]+}", handler.RequireAPIUser(handler.APIRevokeKeyHandler)).Methods("DELETE")
+	api.HandleFunc("/api/v1/availability", handler.RequireAPIUser(handler.APIAvailabilityHandler)).Methods("GET")
+
+	// Client routes
+	api.HandleFunc("/api/v1/reservations", handler.RequireAPIClient(handler.APIListReservationsHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/reservations", handler.RequireAPIClient(handler.APICreateReservationHandler)).Methods("POST")
+	api.HandleFunc("/api/v1/reservations/{id:[0-9]+}", handler.RequireAPIClient(handler.APIGetReservationHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/reservations/{id:[0-9]+}", handler.RequireAPIClient(handler.APIModifyReservationHandler)).Methods("PATCH")
+	api.HandleFunc("/api/v1/reservations/{id:[0-9]+}", handler.RequireAPIClient(handler.APICancelReservationHandler)).Methods("DELETE")
+
+	// Admin routes
+	api.HandleFunc("/api/v1/admin/stats", handler.RequireAPIAdmin(handler.APIAdminStatsHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/admin/reservations", handler.RequireAPIAdmin(handler.APIAdminReservationsHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/admin/reservations/{id:[0-9]+}/confirm", handler.RequireAPIAdmin(handler.APIConfirmReservationHandler)).Methods("POST")
+	api.HandleFunc("/api/v1/admin/reservations/{id:[0-9]+}/reject", handler.RequireAPIAdmin(handler.APIRejectReservationHandler)).Methods("POST")
+	api.HandleFunc("/api/v1/admin/sessions", handler.RequireAPIAdmin(handler.APIAdminSessionsHandler)).Methods("GET")
+	api.HandleFunc("/api/v1/admin/sessions/{id:[0-9]+}", handler.RequireAPIAdmin(handler.APIRevokeSessionHandler)).Methods("DELETE")
+	api.HandleFunc("/api/v1/admin/users/{username}/sessions", handler.RequireAPIAdmin(handler.APIRevokeUserSessionsHandler)).Methods("DELETE")
+
+	if err := handler.CheckOpenAPIRoutes(apiRoutes(api)); err != nil {
+		logging.Fatal("Error checking API routes", "error", err)
+	}
+	return api
+}
+
+// Matches the pattern of a path variable, e.g. ":[0-9]+" in "{id:[0-9]+}"
+var pathVariablePattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// List the routes of the API router in OpenAPI form ("/reservations/{id}")
+func apiRoutes(api *mux.Router) []handler.APIRoute {
+	var routes []handler.APIRoute
+	api.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path = pathVariablePattern.ReplaceAllString(strings.TrimPrefix(path, "/api/v1"), "{$1}")
+		for _, method := range methods {
+			routes = append(routes, handler.APIRoute{Method: method, Path: path})
+		}
+		return nil
+	})
+	return routes
+}
+
 func SetTemplates(t *template.Template) {
 	Templates = t
 }
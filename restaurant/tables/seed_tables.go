@@ -3,13 +3,26 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"progetto/restaurant/server/config"
 	"progetto/restaurant/server/database"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	database.InitDatabase("../server/restaurant.db")
+	// the tool runs from its own directory, next to the server one
+	defaults := config.Default()
+	defaults.Database.Path = "../server/restaurant.db"
+	cfg, printOnly, err := config.LoadForTool(defaults, os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if printOnly {
+		return
+	}
+
+	database.InitDatabase(cfg.Database.Path)
 	defer database.CloseDatabase()
 
 	fmt.Println("=== Populating Tables ===")
@@ -31,16 +44,40 @@ func main() {
 
 	fmt.Printf("Inserting %d physical tables...\n\n", totalTables)
 
-	tableNumber := 1
+	// IDs of the inserted tables, by number of seats
+	tableIDs := make(map[int][]int)
 	for _, tableType := range tables {
 		for i := 0; i < tableType.count; i++ {
-			err := database.InsertTable(tableType.seats)
+			id, err := database.InsertTable(tableType.seats)
 			if err != nil {
-				log.Printf("Error inserting table %d: %v", tableNumber, err)
-			} else {
-				fmt.Printf("Table #%d: %d seats\n", tableNumber, tableType.seats)
+				log.Fatalf("Error inserting table of %d seats: %v", tableType.seats, err)
 			}
-			tableNumber++
+			tableIDs[tableType.seats] = append(tableIDs[tableType.seats], int(id))
+			fmt.Printf("Table #%d: %d seats\n", id, tableType.seats)
+		}
+	}
+
+	// Adjacent tables that can be joined for large parties
+	a1, a2 := tableIDs[4][0], tableIDs[4][1]
+	b1, b2, b3 := tableIDs[4][2], tableIDs[4][3], tableIDs[6][0]
+	groups := []struct {
+		name   string
+		tables []int
+	}{
+		{fmt.Sprintf("Sala A - %d+%d", a1, a2), []int{a1, a2}},            // 4 + 4 seats
+		{fmt.Sprintf("Sala B - %d+%d", b1, b2), []int{b1, b2}},            // 4 + 4 seats
+		{fmt.Sprintf("Sala B - %d+%d+%d", b1, b2, b3), []int{b1, b2, b3}}, // 4 + 4 + 6 seats
+	}
+
+	fmt.Println()
+	fmt.Printf("Inserting %d table groups...\n\n", len(groups))
+
+	for _, group := range groups {
+		_, err := database.InsertTableGroup(group.name, group.tables)
+		if err != nil {
+			log.Printf("Error inserting table group %s: %v", group.name, err)
+		} else {
+			fmt.Printf("Group %s: tables %v\n", group.name, group.tables)
 		}
 	}
 
@@ -61,10 +98,11 @@ func main() {
 	}
 	fmt.Printf("\nTotal capacity: %d seats\n", totalSeats)
 	fmt.Printf("Total tables: %d\n", totalTables)
+	fmt.Printf("Table groups: %d\n", len(groups))
 	fmt.Println()
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println()
 	fmt.Println("	Restaurant ready for reservations!")
-	fmt.Println("   Each table is available for all time slots (12:00-22:00)")
-	fmt.Println("   Reservations last 2 hours per booking")
+	fmt.Println("   Each table is available for all slots of the opening hours")
+	fmt.Println("   Reservation length depends on party size and service period")
 }